@@ -0,0 +1,346 @@
+package traefik_change_response
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	defaultAuditMaxSize    = 100 << 20
+	defaultAuditMaxBackups = 3
+	defaultAuditBufferSize = 1024
+	auditUnhashed          = "unhashed" // body hash of spilled bodies
+)
+
+var (
+	errAuditClosed    = errors.New("audit log is closed")
+	errAuditQueueFull = errors.New("audit queue is full")
+)
+
+// Audit appends a JSON line to a local file for every applied override rule
+type Audit struct {
+	// Path to the audit log file. Required
+	Path string `json:"path"`
+
+	// MaxSize max size of the audit log file in bytes before it is rotated. Optional, default 100MB
+	MaxSize int64 `json:"maxSize,omitempty"`
+
+	// MaxBackups number of rotated files to keep. Optional, default 3
+	MaxBackups int `json:"maxBackups,omitempty"`
+
+	// BufferSize number of records queued for writing. Records are dropped when the queue is full. Optional,
+	// default 1024
+	BufferSize int `json:"bufferSize,omitempty"`
+}
+
+// auditRecord is a single audit log line
+type auditRecord struct {
+	Time           string `json:"time"`
+	Plugin         string `json:"plugin"`
+	RequestID      string `json:"requestId,omitempty"`
+	Method         string `json:"method"`
+	Host           string `json:"host"`
+	URL            string `json:"url"`
+	ClientIP       string `json:"clientIp"`
+	RuleIndex      int    `json:"ruleIndex"`
+	Rule           string `json:"rule"`
+	StatusBefore   int    `json:"statusBefore"`
+	StatusAfter    int    `json:"statusAfter"`
+	BodyHashBefore string `json:"bodyHashBefore"`
+	BodyHashAfter  string `json:"bodyHashAfter"`
+}
+
+// auditWriters are audit log writers shared by plugin instances, keyed by the file path. Traefik builds a new
+// middleware instance on every configuration change, so the instances must not open and rotate the same file on their own
+var auditWriters = struct {
+	sync.Mutex
+	paths map[string]*auditWriter
+}{paths: make(map[string]*auditWriter)}
+
+// auditor queues audit records of a plugin instance
+type auditor struct {
+	writer  *auditWriter
+	onError func(msg string, err error)
+}
+
+// auditWriter writes audit records of all plugin instances sharing the file asynchronously
+type auditWriter struct {
+	path    string
+	records chan []byte
+	done    chan struct{} // closed when the last instance using the writer is done
+	refs    int           // plugin instances using the writer, guarded by auditWriters mutex
+
+	queueing sync.RWMutex // excludes queueing records while the writer is being closed
+	closed   bool         // no records are accepted, guarded by queueing mutex
+
+	mu         sync.Mutex // guards settings below, updated by the latest plugin instance
+	maxSize    int64
+	maxBackups int
+	onError    func(msg string, err error)
+
+	file *os.File
+	size int64
+}
+
+// newAuditor validates audit configuration and starts writing records to the audit log until context is done. Plugin
+// instances with the same audit log path share the writer, the file is closed when all of them are done
+func newAuditor(ctx context.Context, config *Audit, onError func(msg string, err error)) (*auditor, error) {
+	if config.Path == "" {
+		return nil, fmt.Errorf("audit log path is required")
+	}
+
+	if config.MaxSize < 0 || config.MaxBackups < 0 || config.BufferSize < 0 {
+		return nil, fmt.Errorf("audit maxSize, maxBackups and bufferSize must not be negative")
+	}
+
+	if config.MaxSize == 0 {
+		config.MaxSize = defaultAuditMaxSize
+	}
+
+	if config.MaxBackups == 0 {
+		config.MaxBackups = defaultAuditMaxBackups
+	}
+
+	if config.BufferSize == 0 {
+		config.BufferSize = defaultAuditBufferSize
+	}
+
+	path, err := filepath.Abs(config.Path)
+	if err != nil {
+		return nil, fmt.Errorf("invalid audit log path: %w", err)
+	}
+
+	auditWriters.Lock()
+	defer auditWriters.Unlock()
+
+	w := auditWriters.paths[path]
+	if w == nil {
+		w = &auditWriter{
+			path:    path,
+			records: make(chan []byte, config.BufferSize), // buffer size of the first instance is kept
+			done:    make(chan struct{}),
+		}
+
+		w.configure(config, onError)
+
+		if err := w.open(); err != nil {
+			return nil, err
+		}
+
+		auditWriters.paths[path] = w
+
+		go w.run()
+	} else {
+		w.configure(config, onError)
+	}
+
+	w.refs++
+	context.AfterFunc(ctx, w.release)
+
+	return &auditor{writer: w, onError: onError}, nil
+}
+
+// configure applies settings of the plugin instance
+func (w *auditWriter) configure(config *Audit, onError func(msg string, err error)) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.maxSize = config.MaxSize
+	w.maxBackups = config.MaxBackups
+	w.onError = onError
+}
+
+// release stops the writer when the last plugin instance using it is done
+func (w *auditWriter) release() {
+	auditWriters.Lock()
+	defer auditWriters.Unlock()
+
+	if w.refs--; w.refs > 0 {
+		return
+	}
+
+	delete(auditWriters.paths, w.path)
+
+	w.queueing.Lock()
+	w.closed = true
+	w.queueing.Unlock()
+
+	close(w.done) // records queued so far are written before the file is closed
+}
+
+// queue adds record to the writer queue. Never blocks
+func (w *auditWriter) queue(line []byte) error {
+	w.queueing.RLock()
+	defer w.queueing.RUnlock()
+
+	if w.closed {
+		return errAuditClosed
+	}
+
+	select {
+	case w.records <- line:
+		return nil
+	default:
+		return errAuditQueueFull
+	}
+}
+
+// record queues audit record of the override rule applied to the response. Never blocks
+func (a *auditor) record(
+	plugin string,
+	requestID string,
+	req *http.Request,
+	index int,
+	o *Override,
+	before *auditState,
+	after *responseState,
+) {
+	clientIP, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		clientIP = req.RemoteAddr
+	}
+
+	line, _ := json.Marshal(&auditRecord{
+		Time:           time.Now().UTC().Format(time.RFC3339Nano),
+		Plugin:         plugin,
+		RequestID:      requestID,
+		Method:         req.Method,
+		Host:           req.Host,
+		URL:            req.URL.String(),
+		ClientIP:       clientIP,
+		RuleIndex:      index,
+		Rule:           o.Name,
+		StatusBefore:   before.status,
+		StatusAfter:    after.status,
+		BodyHashBefore: before.bodyHash,
+		BodyHashAfter:  after.bodyHash(),
+	})
+
+	if err := a.writer.queue(append(line, '\n')); err != nil {
+		a.onError(err.Error()+", record dropped", nil)
+	}
+}
+
+// run writes queued records to the file until the writer is released
+func (w *auditWriter) run() {
+	defer func() {
+		if w.file != nil {
+			w.file.Close()
+		}
+	}()
+
+	for {
+		select {
+		case line := <-w.records:
+			w.write(line)
+		case <-w.done:
+			for {
+				select {
+				case line := <-w.records:
+					w.write(line)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// write appends line to the file rotating it if needed
+func (w *auditWriter) write(line []byte) {
+	w.mu.Lock()
+	maxSize, maxBackups, onError := w.maxSize, w.maxBackups, w.onError
+	w.mu.Unlock()
+
+	if w.size > 0 && w.size+int64(len(line)) > maxSize {
+		if err := w.rotate(maxBackups); err != nil {
+			onError("cannot rotate audit log", err)
+		}
+	}
+
+	if w.file == nil {
+		if err := w.open(); err != nil {
+			onError("audit record dropped", err)
+
+			return
+		}
+	}
+
+	n, err := w.file.Write(line)
+	w.size += int64(n)
+
+	if err != nil {
+		onError("cannot write audit log", err)
+	}
+}
+
+// open opens audit log file for appending
+func (w *auditWriter) open() error {
+	file, err := os.OpenFile(w.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o640)
+	if err != nil {
+		return fmt.Errorf("cannot open audit log: %w", err)
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+
+		return fmt.Errorf("cannot open audit log: %w", err)
+	}
+
+	w.file = file
+	w.size = info.Size()
+
+	return nil
+}
+
+// rotate renames current file to a backup and opens a new one. The oldest backup is removed
+func (w *auditWriter) rotate(maxBackups int) error {
+	w.file.Close()
+	w.file = nil
+
+	for i := maxBackups - 1; i > 0; i-- {
+		backup := w.path + "." + strconv.Itoa(i)
+		if _, err := os.Stat(backup); err == nil {
+			if err := os.Rename(backup, w.path+"."+strconv.Itoa(i+1)); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := os.Rename(w.path, w.path+".1"); err != nil {
+		return err
+	}
+
+	return w.open()
+}
+
+// auditState is response state before applying the rule
+type auditState struct {
+	status   int
+	bodyHash string
+}
+
+// bodyHash returns response body hash for audit records. Spilled bodies are not hashed, so that processing never
+// blocks on disk
+func (s *responseState) bodyHash() string {
+	if s.spill != nil {
+		return auditUnhashed
+	}
+
+	h := sha256.New()
+	_, _ = s.writeBody(h)
+
+	return "sha256:" + hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,327 @@
+package traefik_change_response_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	changeresponse "github.com/bravepickle/traefik-change-response"
+)
+
+func TestAudit(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	path := filepath.Join(t.TempDir(), "audit.log")
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.WriteHeader(http.StatusInternalServerError)
+		_, _ = rw.Write([]byte("Some error"))
+	})
+
+	config := &changeresponse.Config{
+		Overrides: []changeresponse.Override{
+			{Name: "hide errors", From: []int{500}, To: 200, Body: "Everything is fine"},
+			{From: []int{500}, To: 202, Mode: changeresponse.ModeKeep},
+			{From: []int{404}, To: 200},
+		},
+		Audit: &changeresponse.Audit{Path: path},
+	}
+
+	handler, err := changeresponse.New(ctx, next, config, "test-plugin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "http://localhost/orders?id=1", nil)
+	req.RemoteAddr = "10.0.0.1:12345"
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	lines := waitAuditLines(t, path, 2)
+
+	var record struct {
+		Method         string `json:"method"`
+		URL            string `json:"url"`
+		ClientIP       string `json:"clientIp"`
+		RuleIndex      int    `json:"ruleIndex"`
+		Rule           string `json:"rule"`
+		StatusBefore   int    `json:"statusBefore"`
+		StatusAfter    int    `json:"statusAfter"`
+		BodyHashBefore string `json:"bodyHashBefore"`
+		BodyHashAfter  string `json:"bodyHashAfter"`
+	}
+
+	if err := json.Unmarshal([]byte(lines[0]), &record); err != nil {
+		t.Fatal(err)
+	}
+
+	if record.Method != http.MethodPost || record.URL != "http://localhost/orders?id=1" || record.ClientIP != "10.0.0.1" {
+		t.Errorf("Request fields mismatch: %s", lines[0])
+	}
+
+	if record.RuleIndex != 0 || record.Rule != "hide errors" || record.StatusBefore != 500 || record.StatusAfter != 200 {
+		t.Errorf("Rule fields mismatch: %s", lines[0])
+	}
+
+	if record.BodyHashBefore != sha256Hex("Some error") || record.BodyHashAfter != sha256Hex("Everything is fine") {
+		t.Errorf("Body hashes mismatch: %s", lines[0])
+	}
+
+	if err := json.Unmarshal([]byte(lines[1]), &record); err != nil {
+		t.Fatal(err)
+	}
+
+	if record.RuleIndex != 1 || record.StatusBefore != 200 || record.StatusAfter != 202 {
+		t.Errorf("Chained rule fields mismatch: %s", lines[1])
+	}
+}
+
+func TestAuditRotation(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	path := filepath.Join(t.TempDir(), "audit.log")
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.WriteHeader(http.StatusInternalServerError)
+	})
+
+	config := &changeresponse.Config{
+		Overrides: []changeresponse.Override{{From: []int{500}, To: 200}},
+		Audit:     &changeresponse.Audit{Path: path, MaxSize: 100, MaxBackups: 2},
+	}
+
+	handler, err := changeresponse.New(ctx, next, config, "test-plugin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 5; i++ {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "http://localhost", nil))
+	}
+
+	// every record exceeds max size, so each one is written to a new file
+	waitAuditLines(t, path+".2", 1)
+	waitAuditLines(t, path+".1", 1)
+	waitAuditLines(t, path, 1)
+
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("Backups beyond the limit must be removed: %v", err)
+	}
+}
+
+func TestAuditSpilledBody(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	path := filepath.Join(t.TempDir(), "audit.log")
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.WriteHeader(http.StatusInternalServerError)
+		_, _ = rw.Write(bytes.Repeat([]byte("x"), 2048))
+	})
+
+	config := &changeresponse.Config{
+		Overrides: []changeresponse.Override{{
+			From:       []int{500},
+			To:         200,
+			Mode:       changeresponse.ModeAppend,
+			Body:       "<!-- appended -->",
+			OnOverflow: changeresponse.OverflowSpill,
+		}},
+		MaxBufferBytes: 1024,
+		Audit:          &changeresponse.Audit{Path: path},
+	}
+
+	handler, err := changeresponse.New(ctx, next, config, "test-plugin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "http://localhost", nil))
+
+	// spilled bodies are not read back from disk to be hashed
+	lines := waitAuditLines(t, path, 1)
+	if !strings.Contains(lines[0], `"bodyHashBefore":"unhashed","bodyHashAfter":"unhashed"`) {
+		t.Errorf("Spilled body hashes mismatch: %s", lines[0])
+	}
+}
+
+func TestAuditClosed(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	out, errOut := &lockedBuffer{}, &lockedBuffer{}
+	captureLogs(t, out, errOut)
+
+	path := filepath.Join(t.TempDir(), "audit.log")
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.WriteHeader(http.StatusInternalServerError)
+	})
+
+	config := &changeresponse.Config{
+		Overrides: []changeresponse.Override{{From: []int{500}, To: 200}},
+		Audit:     &changeresponse.Audit{Path: path},
+	}
+
+	handler, err := changeresponse.New(ctx, next, config, "test-plugin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "http://localhost", nil))
+	cancel()
+
+	// records of responses finished after the writer is closed are reported as dropped
+	served := 1
+	deadline := time.Now().Add(time.Second)
+
+	for !strings.Contains(errOut.String(), "audit log is closed, record dropped") {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected dropped record warning, got: %s", errOut.String())
+		}
+
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "http://localhost", nil))
+		served++
+		time.Sleep(time.Millisecond)
+	}
+
+	// every record queued before closing is written
+	dropped := strings.Count(errOut.String(), "audit log is closed, record dropped")
+	waitAuditLines(t, path, served-dropped)
+}
+
+func TestAuditSharedPath(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.WriteHeader(http.StatusInternalServerError)
+	})
+
+	// rebuilt middleware instance writes to the same file as the previous one
+	handlers := make([]http.Handler, 2)
+	cancels := make([]context.CancelFunc, 2)
+
+	for i := range handlers {
+		var ctx context.Context
+		ctx, cancels[i] = context.WithCancel(context.Background())
+		defer cancels[i]()
+
+		config := &changeresponse.Config{
+			Overrides: []changeresponse.Override{{From: []int{500}, To: 200}},
+			Audit:     &changeresponse.Audit{Path: path, MaxSize: 1000, MaxBackups: 20},
+		}
+
+		handler, err := changeresponse.New(ctx, next, config, "test-plugin")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		handlers[i] = handler
+	}
+
+	var wg sync.WaitGroup
+	for _, handler := range handlers {
+		wg.Add(1)
+
+		go func(handler http.Handler) {
+			defer wg.Done()
+
+			for i := 0; i < 10; i++ {
+				handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "http://localhost", nil))
+			}
+		}(handler)
+	}
+
+	wg.Wait()
+	waitAuditRecords(t, path, 20)
+
+	// writer is kept open while any instance using it is alive
+	cancels[0]()
+	handlers[1].ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "http://localhost", nil))
+	waitAuditRecords(t, path, 21)
+}
+
+// waitAuditRecords waits for the audit log and its backups to contain the number of valid records
+func waitAuditRecords(t *testing.T, path string, count int) {
+	t.Helper()
+
+	var lines []string
+	deadline := time.Now().Add(time.Second)
+
+	for time.Now().Before(deadline) {
+		lines = lines[:0]
+
+		files, _ := filepath.Glob(path + "*")
+		for _, name := range files {
+			if file, err := os.Open(name); err == nil {
+				scanner := bufio.NewScanner(file)
+				for scanner.Scan() {
+					lines = append(lines, scanner.Text())
+				}
+
+				file.Close()
+			}
+		}
+
+		if len(lines) >= count {
+			break
+		}
+
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	if len(lines) != count {
+		t.Fatalf("Expected %d audit records in %s*, got %d", count, path, len(lines))
+	}
+
+	for _, line := range lines {
+		if !json.Valid([]byte(line)) {
+			t.Errorf("Invalid audit record: %s", line)
+		}
+	}
+}
+
+// waitAuditLines waits for the audit log to contain the number of lines
+func waitAuditLines(t *testing.T, path string, count int) []string {
+	t.Helper()
+
+	var lines []string
+	deadline := time.Now().Add(time.Second)
+
+	for time.Now().Before(deadline) {
+		lines = lines[:0]
+
+		if file, err := os.Open(path); err == nil {
+			scanner := bufio.NewScanner(file)
+			for scanner.Scan() {
+				lines = append(lines, scanner.Text())
+			}
+
+			file.Close()
+		}
+
+		if len(lines) >= count {
+			return lines
+		}
+
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	t.Fatalf("Expected %d audit lines in %s, got %d", count, path, len(lines))
+
+	return nil
+}
+
+func sha256Hex(body string) string {
+	sum := sha256.Sum256([]byte(body))
+
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
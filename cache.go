@@ -0,0 +1,128 @@
+package traefik_change_response
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+// Cache policy modes
+const (
+	CacheAuto    = "auto"
+	CacheKeep    = "keep"
+	CacheNoStore = "no-store"
+	CacheMaxAge  = "max-age"
+)
+
+// Cache validators handling
+const (
+	ValidatorsAuto  = "auto"
+	ValidatorsKeep  = "keep"
+	ValidatorsStrip = "strip"
+)
+
+// Cache defines caching of responses modified by the rule
+type Cache struct {
+	// Mode of setting Cache-Control header. Optional
+	// Allowed:
+	//   auto (default) - set no-store if status code class changed, e.g. 5xx to 2xx, keep upstream value otherwise
+	//   keep - keep upstream value
+	//   no-store - forbid caching
+	//   max-age - allow caching for maxAge seconds. Default if maxAge is defined
+	Mode string `json:"mode,omitempty"`
+
+	// MaxAge number of seconds response may be cached for in max-age mode. Optional
+	MaxAge int `json:"maxAge,omitempty"`
+
+	// StaleIfError number of seconds cached response may be used if revalidation fails, added in max-age and keep
+	// modes. Optional
+	StaleIfError int `json:"staleIfError,omitempty"`
+
+	// Validators handling of ETag and Last-Modified headers. Optional
+	// Allowed:
+	//   auto (default) - strip validators if body was modified
+	//   keep - keep upstream validators
+	//   strip - always strip validators
+	Validators string `json:"validators,omitempty"`
+}
+
+// validateCache validates cache policy and sets defaults
+func validateCache(c *Cache) error {
+	if c.MaxAge < 0 || c.StaleIfError < 0 {
+		return fmt.Errorf("maxAge and staleIfError must not be negative")
+	}
+
+	if c.Mode == "" {
+		c.Mode = CacheAuto
+		if c.MaxAge > 0 {
+			c.Mode = CacheMaxAge
+		}
+	}
+
+	switch c.Mode {
+	case CacheAuto, CacheKeep, CacheNoStore, CacheMaxAge:
+	default:
+		return fmt.Errorf("unsupported cache mode: %s", c.Mode)
+	}
+
+	switch c.Validators {
+	case "":
+		c.Validators = ValidatorsAuto
+	case ValidatorsAuto, ValidatorsKeep, ValidatorsStrip:
+	default:
+		return fmt.Errorf("unsupported cache validators handling: %s", c.Validators)
+	}
+
+	return nil
+}
+
+// defaultCache is the cache policy of rules not defining their own
+var defaultCache = &Cache{Mode: CacheAuto, Validators: ValidatorsAuto}
+
+// applyCache sets caching headers of the response modified by override rules
+func (s *responseState) applyCache(originalStatus int) {
+	c := s.cache
+	if c == nil {
+		c = defaultCache
+	}
+
+	headers := s.headers
+
+	switch c.Mode {
+	case CacheAuto:
+		if originalStatus/100 != s.status/100 {
+			headers.Set("Cache-Control", "no-store")
+			headers.Del("Expires")
+		}
+	case CacheNoStore:
+		headers.Set("Cache-Control", "no-store")
+		headers.Del("Expires")
+	case CacheMaxAge:
+		value := "max-age=" + strconv.Itoa(c.MaxAge)
+		if c.StaleIfError > 0 {
+			value += ", stale-if-error=" + strconv.Itoa(c.StaleIfError)
+		}
+
+		headers.Set("Cache-Control", value)
+		headers.Del("Expires")
+	case CacheKeep:
+		if c.StaleIfError > 0 {
+			value := "stale-if-error=" + strconv.Itoa(c.StaleIfError)
+			if upstream := headers.Get("Cache-Control"); upstream != "" {
+				value = upstream + ", " + value
+			}
+
+			headers.Set("Cache-Control", value)
+		}
+	}
+
+	if c.Validators == ValidatorsStrip || (c.Validators == ValidatorsAuto && s.bodyChanged) {
+		stripValidators(headers)
+	}
+}
+
+// stripValidators removes cache validators that do not match modified body
+func stripValidators(headers http.Header) {
+	headers.Del("ETag")
+	headers.Del("Last-Modified")
+}
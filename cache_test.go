@@ -0,0 +1,142 @@
+package traefik_change_response_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	changeresponse "github.com/bravepickle/traefik-change-response"
+)
+
+func TestCache(t *testing.T) {
+	upstream := http.Header{
+		"Cache-Control": []string{"public, max-age=60"},
+		"Expires":       []string{"Thu, 01 Jan 2037 00:00:00 GMT"},
+		"Etag":          []string{`"v1"`},
+		"Last-Modified": []string{"Thu, 01 Jan 2026 00:00:00 GMT"},
+	}
+
+	datasets := []struct {
+		name      string
+		overrides []changeresponse.Override
+		expected  map[string]string
+	}{
+		{
+			name:      "status class changed",
+			overrides: []changeresponse.Override{{From: []int{500}, To: 200, Body: "Everything is fine"}},
+			expected: map[string]string{
+				"Cache-Control": "no-store",
+				"Expires":       "",
+				"Etag":          "",
+				"Last-Modified": "",
+			},
+		},
+		{
+			name:      "status class kept",
+			overrides: []changeresponse.Override{{From: []int{500}, To: 503, Mode: changeresponse.ModeKeep}},
+			expected: map[string]string{
+				"Cache-Control": "public, max-age=60",
+				"Expires":       "Thu, 01 Jan 2037 00:00:00 GMT",
+				"Etag":          `"v1"`,
+				"Last-Modified": "Thu, 01 Jan 2026 00:00:00 GMT",
+			},
+		},
+		{
+			name: "max age",
+			overrides: []changeresponse.Override{{
+				From:  []int{500},
+				To:    200,
+				Mode:  changeresponse.ModeKeep,
+				Cache: &changeresponse.Cache{MaxAge: 10, StaleIfError: 300, Validators: changeresponse.ValidatorsStrip},
+			}},
+			expected: map[string]string{
+				"Cache-Control": "max-age=10, stale-if-error=300",
+				"Expires":       "",
+				"Etag":          "",
+				"Last-Modified": "",
+			},
+		},
+		{
+			name: "keep",
+			overrides: []changeresponse.Override{{
+				From:  []int{500},
+				To:    200,
+				Body:  "Everything is fine",
+				Cache: &changeresponse.Cache{Mode: changeresponse.CacheKeep, StaleIfError: 300, Validators: changeresponse.ValidatorsKeep},
+			}},
+			expected: map[string]string{
+				"Cache-Control": "public, max-age=60, stale-if-error=300",
+				"Expires":       "Thu, 01 Jan 2037 00:00:00 GMT",
+				"Etag":          `"v1"`,
+			},
+		},
+		{
+			name: "last rule wins",
+			overrides: []changeresponse.Override{
+				{From: []int{500}, To: 200, Cache: &changeresponse.Cache{Mode: changeresponse.CacheKeep}},
+				{From: []int{500}, To: 503, Mode: changeresponse.ModeKeep, Cache: &changeresponse.Cache{Mode: changeresponse.CacheNoStore}},
+				{From: []int{500}, To: 503, Mode: changeresponse.ModeKeep},
+			},
+			expected: map[string]string{
+				"Cache-Control": "no-store",
+				"Etag":          "",
+			},
+		},
+	}
+
+	for _, d := range datasets {
+		t.Run(d.name, func(t *testing.T) {
+			recorder := servePlugin(t, inputDataset{
+				config:          changeresponse.Config{Overrides: d.overrides},
+				responseCode:    http.StatusInternalServerError,
+				responseHeaders: upstream,
+				responseBody:    "Some error",
+			})
+
+			for name, expected := range d.expected {
+				if actual := recorder.Header().Get(name); actual != expected {
+					t.Errorf("%s header mismatch: got %q, want %q", name, actual, expected)
+				}
+			}
+		})
+	}
+}
+
+func TestCacheConfig(t *testing.T) {
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {})
+
+	datasets := []struct {
+		name     string
+		cache    changeresponse.Cache
+		expected string
+	}{
+		{
+			name:     "unsupported mode",
+			cache:    changeresponse.Cache{Mode: "forever"},
+			expected: "override 0: cache: unsupported cache mode: forever",
+		},
+		{
+			name:     "unsupported validators",
+			cache:    changeresponse.Cache{Validators: "rewrite"},
+			expected: "override 0: cache: unsupported cache validators handling: rewrite",
+		},
+		{
+			name:     "negative max age",
+			cache:    changeresponse.Cache{MaxAge: -1},
+			expected: "override 0: cache: maxAge and staleIfError must not be negative",
+		},
+	}
+
+	for _, d := range datasets {
+		t.Run(d.name, func(t *testing.T) {
+			config := &changeresponse.Config{
+				Overrides: []changeresponse.Override{{From: []int{500}, To: 200, Cache: &d.cache}},
+			}
+
+			_, err := changeresponse.New(context.Background(), next, config, "test-plugin")
+			if err == nil || err.Error() != d.expected {
+				t.Errorf("Unexpected error\nactual:   %v\nexpected: %s", err, d.expected)
+			}
+		})
+	}
+}
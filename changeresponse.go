@@ -2,44 +2,118 @@
 package traefik_change_response
 
 import (
-	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
 	"net/http"
-	"os"
+	"sync/atomic"
+	"time"
 )
 
-// Notify sends info message to the main application notification
-var Notify = func(msg string) {
-	os.Stdout.WriteString("[changeresponse.DEBUG] " + msg)
-}
-
-// Alert sends error message to the main application notification
-var Alert = func(msg string) {
-	os.Stderr.WriteString("[changeresponse.ERROR] " + msg)
-}
+const redactedValue = "***" // replaces secrets in logged config
 
 // Config the plugin configuration.
 type Config struct {
 	Overrides []Override `json:"overrides"`
 	Debug     bool       `json:"debug,omitempty"` // debug plugin - verbose mode
+
+	// RulesFile path to a JSON or YAML file with override rules to use instead of overrides. The file is reloaded
+	// when it changes. Optional
+	RulesFile string `json:"rulesFile,omitempty"`
+
+	// StrictEnv fails plugin initialization if ${VAR} references an undefined environment variable without a default
+	// value. Optional, undefined variables resolve to empty string by default
+	StrictEnv bool `json:"strictEnv,omitempty"`
+
+	// RulesPollInterval how often to check rules file for changes, e.g. 10s. Optional, default 5s
+	RulesPollInterval string `json:"rulesPollInterval,omitempty"`
+
+	// DebugSecret enables debug headers only for requests with DebugHeader set to this value. Optional
+	DebugSecret string `json:"debugSecret,omitempty"`
+
+	// DebugHeader name of request header to send debug secret in. Optional, default X-Change-Response-Debug
+	DebugHeader string `json:"debugHeader,omitempty"`
+
+	// LogLevel min severity of log records: debug, info (default), warn, error. Debug mode sets debug level. Optional
+	LogLevel string `json:"logLevel,omitempty"`
+
+	// LogFormat format of log records: json (default), logfmt. Optional
+	LogFormat string `json:"logFormat,omitempty"`
+
+	// LogBodyLimit max number of response body bytes in debug log records. Optional, bodies are not logged by default
+	LogBodyLimit int `json:"logBodyLimit,omitempty"`
+
+	// MaxBufferBytes max number of response body bytes to buffer in memory. Rules define what happens to larger
+	// responses. Optional, unlimited by default
+	MaxBufferBytes int64 `json:"maxBufferBytes,omitempty"`
+
+	// MetricsPath request URL path to respond with plugin metrics in Prometheus text format. Optional
+	MetricsPath string `json:"metricsPath,omitempty"`
+
+	// DryRun evaluates all override rules and reports changes they would make without applying them. Optional
+	DryRun bool `json:"dryRun,omitempty"`
+
+	// CircuitBreaker returns fast failures without calling the backend when it keeps failing. Optional
+	CircuitBreaker *CircuitBreaker `json:"circuitBreaker,omitempty"`
+
+	// Fault injects failures into matching requests for chaos testing. Optional
+	Fault *Fault `json:"fault,omitempty"`
+
+	// RequestID propagates request correlation ID, generating a new one when it is missing. Optional
+	RequestID *RequestID `json:"requestId,omitempty"`
+
+	// Audit appends a record of every applied override rule to a local file. Optional
+	Audit *Audit `json:"audit,omitempty"`
+
+	// SecurityHeaders sets a preset of security headers in all responses before override rules are applied. Optional
+	SecurityHeaders *SecurityHeaders `json:"securityHeaders,omitempty"`
+
+	// CORS sets cross-origin resource sharing headers in responses modified by override rules not defining their own.
+	// Optional
+	CORS *CORS `json:"cors,omitempty"`
+
+	// Integrity defines handling of ETag and digest headers of responses with bodies modified by override rules.
+	// Optional, the headers are dropped by default
+	Integrity *Integrity `json:"integrity,omitempty"`
+
+	// Signing signs responses with HMAC, so that clients can verify them. Optional
+	Signing *Signing `json:"signing,omitempty"`
 }
 
 // Override is a single override rule for the plugin
 type Override struct {
+	// Name of the rule to refer to in debug headers and metrics. Optional
+	Name string `json:"name,omitempty"`
+
 	// From list of HTTP status codes to match against to apply this override rule. Required
 	From []int `json:"from"`
 
 	// To status code to substitute the initial one. Required
 	To int `json:"to"`
 
-	// Headers sets defined headers in response. Optional
+	// Headers sets defined headers in response. Values support {{name}} placeholders. Optional
 	Headers http.Header `json:"headers,omitempty"`
 
 	// RemoveHeaders removes upstream response headers if matched override. Optional
-	RemoveHeaders []string `json:"removeHeaders,omitempty"`
+	RemoveHeaders []string `json:"removeHeaders,omitempty" list:"comma"`
+
+	// SecurityHeaders sets a preset of security headers after headers are removed and before headers are set. Optional
+	SecurityHeaders *SecurityHeaders `json:"securityHeaders,omitempty"`
 
-	// Body overrides body contents - based on mode rule selected. Optional
+	// HeaderOps list of header operations to apply in order after headers are set and removed. Optional
+	HeaderOps []HeaderOp `json:"headerOps,omitempty"`
+
+	// Cookies modifies cookies set by the response after header operations are applied. Optional
+	Cookies *Cookies `json:"cookies,omitempty"`
+
+	// CORS sets cross-origin resource sharing headers after cookies are modified. Optional, defaults to plugin CORS
+	CORS *CORS `json:"cors,omitempty"`
+
+	// Cache defines caching of modified responses. The last applied rule defining it wins. Optional, by default
+	// caching is forbidden if status code class changed and validators are stripped if body was modified
+	Cache *Cache `json:"cache,omitempty"`
+
+	// Body overrides body contents - based on mode rule selected. Supports {{name}} placeholders. Optional
 	Body string `json:"body,omitempty"`
 
 	// Mode Replaces body in a specified manner. Optional
@@ -48,7 +122,37 @@ type Override struct {
 	//   keep - keep body as it is
 	//   append - append extra body contents to the end
 	//   prepend - prepend extra body contents
+	//   inject - insert body contents at the anchor of HTML responses
+	//   xml - transform XML body elements, body contents are ignored
+	//   envelope - wrap JSON body into an envelope object, body contents are ignored
+	//   unwrap - extract sub-document of JSON body, body contents are ignored
 	Mode string `json:"mode,omitempty"`
+
+	// Anchor of HTML body to insert contents at in inject mode: </body> (default), <body>, </head>, <head>. Optional
+	Anchor string `json:"anchor,omitempty"`
+
+	// XML transformation of the body in xml mode. The rule applies only to bodies containing its match element.
+	// Required in xml mode
+	XML *XMLTransform `json:"xml,omitempty"`
+
+	// Envelope of JSON body in envelope and unwrap modes. Optional in envelope mode, required in unwrap mode
+	Envelope *Envelope `json:"envelope,omitempty"`
+
+	// Convert converts body to another format after it is modified according to the mode. Optional
+	Convert *Convert `json:"convert,omitempty"`
+
+	// DryRun reports changes this rule would make without applying them. Optional
+	DryRun bool `json:"dryRun,omitempty"`
+
+	// OnOverflow policy for matched responses with body exceeding max buffer size. Optional
+	// Allowed:
+	//   passthrough (default) - send the response untouched
+	//   spill - buffer body in a temporary file and apply the rule
+	//   fail - respond with overflow status code
+	OnOverflow string `json:"onOverflow,omitempty"`
+
+	// OverflowStatus status code to respond with for the fail overflow policy. Optional, default 502
+	OverflowStatus int `json:"overflowStatus,omitempty"`
 }
 
 // CreateConfig creates the default plugin configuration.
@@ -58,9 +162,19 @@ func CreateConfig() *Config {
 
 // Plugin a plugin main entity.
 type Plugin struct {
-	next   http.Handler
-	name   string
-	config *Config
+	next     http.Handler
+	name     string
+	config   *Config
+	rules    *atomic.Value // *ruleSet, shared by instances watching the same rules file
+	logger   Logger
+	logLevel LogLevel
+	metrics  *Metrics
+	breakers *circuitBreakers
+	fault    *faultInjector
+	audit    *auditor
+
+	securityHeaders *securityHeaders
+	signer          *signer
 }
 
 // New created a new plugin.
@@ -69,24 +183,279 @@ func New(ctx context.Context, next http.Handler, config *Config, name string) (h
 		return nil, fmt.Errorf("config must be defined")
 	}
 
-	if len(config.Overrides) == 0 {
+	defined, _ := json.Marshal(config) // before resolving secrets
+	redacted, _ := json.Marshal(redactConfig(config))
+
+	if err := interpolateConfig(config); err != nil {
+		return nil, err
+	}
+
+	if len(config.Overrides) == 0 && config.RulesFile == "" {
 		return nil, fmt.Errorf("at least one override rule is required")
 	}
 
+	if len(config.Overrides) > 0 && config.RulesFile != "" {
+		return nil, fmt.Errorf("overrides and rulesFile are mutually exclusive")
+	}
+
+	if config.MaxBufferBytes < 0 {
+		return nil, fmt.Errorf("maxBufferBytes must not be negative: %d", config.MaxBufferBytes)
+	}
+
+	logger, err := NewStreamLogger(LogOutput, LogErrorOutput, config.LogFormat)
+	if err != nil {
+		return nil, err
+	}
+
+	plugin := &Plugin{
+		next:     next,
+		name:     name,
+		config:   config,
+		rules:    &atomic.Value{},
+		logger:   logger,
+		logLevel: LevelInfo,
+		metrics:  newMetrics(name),
+	}
+
 	if config.Debug {
-		Notify(fmt.Sprintf("defined config %s: %v", name, config))
+		plugin.logLevel = LevelDebug
+	}
+
+	if config.LogLevel != "" {
+		if plugin.logLevel, err = parseLogLevel(config.LogLevel); err != nil {
+			return nil, err
+		}
+	}
+
+	var rulesInterval time.Duration
+	var rulesState rulesFileState
+
+	if config.RulesFile != "" {
+		if rulesInterval, err = rulesPollInterval(config.RulesPollInterval); err != nil {
+			return nil, err
+		}
+
+		if rulesState, err = plugin.readRules(config.RulesFile); err != nil {
+			return nil, err
+		}
+	} else {
+		rules, err := compileRules(config.Overrides, config)
+		if err != nil {
+			return nil, err
+		}
+
+		plugin.rules.Store(rules)
+	}
+
+	if config.RequestID != nil {
+		if err := validateRequestID(config.RequestID); err != nil {
+			return nil, err
+		}
+	}
+
+	if config.CircuitBreaker != nil {
+		breakers, err := newCircuitBreakers(config.CircuitBreaker)
+		if err != nil {
+			return nil, err
+		}
+
+		plugin.breakers = breakers
+	}
+
+	if config.Fault != nil {
+		fault, err := newFaultInjector(config.Fault)
+		if err != nil {
+			return nil, err
+		}
+
+		plugin.fault = fault
+	}
+
+	if config.SecurityHeaders != nil {
+		if plugin.securityHeaders, err = compileSecurityHeaders(config.SecurityHeaders); err != nil {
+			return nil, fmt.Errorf("securityHeaders: %w", err)
+		}
+	}
+
+	if config.Integrity != nil {
+		if err = validateIntegrity(config.Integrity); err != nil {
+			return nil, fmt.Errorf("integrity: %w", err)
+		}
+	}
+
+	if config.Signing != nil {
+		if plugin.signer, err = newSigner(config.Signing); err != nil {
+			return nil, fmt.Errorf("signing: %w", err)
+		}
+	}
+
+	if config.Audit != nil {
+		audit, err := newAuditor(ctx, config.Audit, func(msg string, err error) {
+			record := &LogRecord{Message: msg}
+			if err != nil {
+				record.Error = err.Error()
+			}
+
+			plugin.log(LevelWarn, record)
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		plugin.audit = audit
+	}
+
+	if config.RulesFile != "" { // started last, so that failed configuration leaves nothing running
+		plugin.watchRules(ctx, string(defined), rulesInterval, rulesState)
+	}
+
+	plugin.log(LevelDebug, &LogRecord{Message: "defined config", Fields: map[string]string{"config": string(redacted)}})
+
+	return plugin, nil
+}
+
+// redactConfig returns copy of the config with secrets masked to be logged
+func redactConfig(config *Config) *Config {
+	c := *config
+
+	if c.DebugSecret != "" {
+		c.DebugSecret = redactedValue
+	}
+
+	if c.Fault != nil && c.Fault.Secret != "" {
+		fault := *c.Fault
+		fault.Secret = redactedValue
+		c.Fault = &fault
+	}
+
+	if c.Signing != nil {
+		signing := *c.Signing
+		signing.Keys = make([]SigningKey, len(c.Signing.Keys))
+
+		for i, key := range c.Signing.Keys {
+			key.Secret = redactedValue
+			signing.Keys[i] = key
+		}
+
+		c.Signing = &signing
 	}
 
-	return &Plugin{
-		next:   next,
-		name:   name,
-		config: config,
-	}, nil
+	return &c
 }
 
 // ServeHTTP processes requests/responses as a middleware
 func (a *Plugin) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
-	wrapper := &ResponseWriterWrapper{body: &bytes.Buffer{}, ResponseWriter: rw}
+	if a.config.MetricsPath != "" && req.URL.Path == a.config.MetricsPath {
+		a.metrics.ServeHTTP(rw, req)
+
+		return
+	}
+
+	a.metrics.countRequest()
+
+	if a.config.RequestID != nil {
+		a.ensureRequestID(req)
+	}
+
+	wrapper := newResponseWriterWrapper(rw, a)
+	wrapper.debug = a.debugEnabled(req) // checked once as debug header is removed from the request
+
+	if a.config.RequestID != nil {
+		wrapper.requestID = a.requestID(req)
+	}
+	defer wrapper.free()
+
+	if a.fault != nil && a.fault.match(req) {
+		a.serveFault(wrapper, req)
+
+		return
+	}
+
+	if a.breakers != nil {
+		key := a.breakers.key(req)
+		state, ok, retryAfter := a.breakers.allow(key)
+
+		if !ok {
+			if wrapper.debug {
+				rw.Header().Set("X-Circuit-Breaker", circuitDebugHeader(state, key))
+			}
+
+			if a.config.RequestID != nil {
+				rw.Header().Set(a.config.RequestID.Header, a.requestID(req))
+			}
+
+			reject := a.breakers.reject(rw.Header(), retryAfter)
+			if a.signer != nil {
+				a.signer.sign(reject)
+			}
+
+			rw.WriteHeader(reject.status)
+
+			if _, err := reject.writeBody(rw); err != nil {
+				a.log(LevelError, &LogRecord{Message: "cannot write circuit breaker response body", Error: err.Error()})
+			}
+
+			return
+		}
+
+		wrapper.circuitKey = key
+		wrapper.circuitState = state
+
+		defer func() {
+			if wrapper.circuitState != "" { // response was not recorded, e.g. the backend handler panicked
+				a.breakers.release(key, state)
+			}
+		}()
+	}
+
 	a.next.ServeHTTP(wrapper, req)
-	changeResponse(wrapper, a)
+	changeResponse(wrapper, req, a)
+}
+
+// serveFault processes request with injected faults
+func (a *Plugin) serveFault(wrapper *ResponseWriterWrapper, req *http.Request) {
+	if wrapper.debug {
+		wrapper.Header().Set("X-Fault-Injected", a.fault.actions())
+	}
+
+	if !a.fault.wait(req) {
+		return // client has gone away
+	}
+
+	if a.fault.config.Abort != nil {
+		a.fault.abort(wrapper)
+	} else {
+		a.next.ServeHTTP(wrapper, req)
+		a.fault.truncate(wrapper)
+	}
+
+	changeResponse(wrapper, req, a)
+}
+
+// currentRules returns override rules in effect
+func (a *Plugin) currentRules() *ruleSet {
+	return a.rules.Load().(*ruleSet)
+}
+
+// Metrics returns plugin metrics collector, e.g. to expose metrics when embedding the plugin
+func (a *Plugin) Metrics() *Metrics {
+	return a.metrics
+}
+
+// logEnabled checks if records of the level are logged
+func (a *Plugin) logEnabled(level LogLevel) bool {
+	return level >= a.logLevel
+}
+
+// log writes record if its level is enabled
+func (a *Plugin) log(level LogLevel, record *LogRecord) {
+	if !a.logEnabled(level) {
+		return
+	}
+
+	record.Time = time.Now()
+	record.Level = level
+	record.Plugin = a.name
+
+	a.logger.Log(record)
 }
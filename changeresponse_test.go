@@ -3,6 +3,7 @@ package traefik_change_response_test
 import (
 	"bytes"
 	"context"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"slices"
@@ -94,6 +95,7 @@ func TestChangeResponse(t *testing.T) {
 			},
 			expectedCode: 204,
 			expectedHeaders: http.Header{
+				"Cache-Control":  []string{"no-store"},
 				"Server":         []string{"dummy server"},
 				"Content-Type":   []string{"application/json"},
 				"Content-Length": []string{"0"},
@@ -158,6 +160,7 @@ func TestChangeResponse(t *testing.T) {
 			},
 			expectedCode: 200,
 			expectedHeaders: http.Header{
+				"Cache-Control":  []string{"no-store"},
 				"Server":         []string{"dummy server"},
 				"Content-Type":   []string{"text/plain"},
 				"Content-Length": []string{strconv.Itoa(len("Everything is fine"))},
@@ -189,6 +192,7 @@ func TestChangeResponse(t *testing.T) {
 			},
 			expectedCode: 200,
 			expectedHeaders: http.Header{
+				"Cache-Control":  []string{"no-store"},
 				"Server":         []string{"dummy server"},
 				"Content-Type":   []string{"text/plain"},
 				"Content-Length": []string{strconv.Itoa(len("Some error\nEverything is fine"))},
@@ -220,6 +224,7 @@ func TestChangeResponse(t *testing.T) {
 			},
 			expectedCode: 200,
 			expectedHeaders: http.Header{
+				"Cache-Control":  []string{"no-store"},
 				"Server":         []string{"dummy server"},
 				"Content-Type":   []string{"text/plain"},
 				"Content-Length": []string{strconv.Itoa(len("Everything is fine\nSome error"))},
@@ -252,6 +257,7 @@ func TestChangeResponse(t *testing.T) {
 			},
 			expectedCode: 400,
 			expectedHeaders: http.Header{
+				"Cache-Control":  []string{"no-store"},
 				"X-Foo":          []string{"bar", "baz"},
 				"Server":         []string{"dummy server"},
 				"Content-Type":   []string{"text/plain"},
@@ -295,6 +301,7 @@ func TestChangeResponse(t *testing.T) {
 			},
 			expectedCode: 404,
 			expectedHeaders: http.Header{
+				"Cache-Control":  []string{"no-store"},
 				"X-Foo":          []string{"far"},
 				"X-Foo-2":        []string{"fom"},
 				"Server":         []string{"dummy server"},
@@ -336,6 +343,104 @@ func TestChangeResponse(t *testing.T) {
 			},
 			expectedBody: "Client response",
 		},
+		{
+			input: inputDataset{
+				name: "dry run",
+				config: changeresponse.Config{
+					Overrides: []changeresponse.Override{
+						{
+							From: []int{500},
+							To:   200,
+							Headers: http.Header{
+								"Content-Type": []string{"text/plain"},
+							},
+							Body: "Everything is fine",
+						},
+					},
+					DryRun: true,
+				},
+				responseCode: 500,
+				responseHeaders: http.Header{
+					"Server":       []string{"dummy server"},
+					"Content-Type": []string{"text/plain; charset=utf-8"},
+				},
+				responseBody: "Some error",
+			},
+			expectedCode: 500,
+			expectedHeaders: http.Header{
+				"Server":                        []string{"dummy server"},
+				"Content-Type":                  []string{"text/plain; charset=utf-8"},
+				"Content-Length":                []string{strconv.Itoa(len("Some error"))},
+				"X-Change-Response-Would-Apply": []string{"rule=0 to=200 size=18"},
+			},
+			expectedBody: "Some error",
+		},
+		{
+			input: inputDataset{
+				name: "dry run rule",
+				config: changeresponse.Config{
+					Overrides: []changeresponse.Override{
+						{
+							From: []int{500},
+							To:   502,
+							Mode: changeresponse.ModeAppend,
+							Body: "\nFirst step",
+						},
+						{
+							From:   []int{500},
+							To:     200,
+							Mode:   changeresponse.ModeAppend,
+							Body:   "\nSecond step",
+							DryRun: true,
+						},
+					},
+				},
+				responseCode: 500,
+				responseHeaders: http.Header{
+					"Content-Type": []string{"text/plain"},
+				},
+				responseBody: "Some error",
+			},
+			expectedCode: 502,
+			expectedHeaders: http.Header{
+				"Content-Type":                  []string{"text/plain"},
+				"Content-Length":                []string{strconv.Itoa(len("Some error\nFirst step"))},
+				"X-Change-Response-Would-Apply": []string{"rule=1 to=200 size=33"},
+			},
+			expectedBody: "Some error\nFirst step",
+		},
+		{
+			input: inputDataset{
+				name: "duplicate status codes",
+				config: changeresponse.Config{
+					Overrides: []changeresponse.Override{
+						{
+							From: []int{404, 500, 500},
+							To:   502,
+							Mode: changeresponse.ModeAppend,
+							Body: "\nFirst step",
+						},
+						{
+							From: []int{503},
+							To:   200,
+						},
+						{
+							From: []int{500},
+							To:   503,
+							Mode: changeresponse.ModeAppend,
+							Body: "\nSecond step",
+						},
+					},
+				},
+				responseCode: 500,
+				responseBody: "Some error",
+			},
+			expectedCode: 503,
+			expectedHeaders: http.Header{
+				"Content-Length": []string{strconv.Itoa(len("Some error\nFirst step\nSecond step"))},
+			},
+			expectedBody: "Some error\nFirst step\nSecond step",
+		},
 	}
 
 	for _, d := range datasets {
@@ -584,13 +689,120 @@ func BenchmarkChangeResponse(t *testing.B) {
 
 	for _, d := range datasets {
 		t.Run(d.name, func(t *testing.B) {
-			servePlugin(t, d)
+			handler := newPluginHandler(t, d)
+			rw := &benchResponseWriter{header: http.Header{}}
+
+			req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, "http://localhost", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			t.ReportAllocs()
+			t.ResetTimer()
+
+			for i := 0; i < t.N; i++ {
+				rw.reset()
+				handler.ServeHTTP(rw, req)
+			}
+		})
+	}
+}
+
+// TestAllocations tracks allocations made per request for matched and not matched responses
+func TestAllocations(t *testing.T) {
+	datasets := []struct {
+		input     inputDataset
+		maxAllocs float64
+	}{
+		{
+			input: inputDataset{
+				name: "match",
+				config: changeresponse.Config{
+					Overrides: []changeresponse.Override{{
+						From:    []int{500},
+						To:      200,
+						Headers: http.Header{"Content-Type": []string{"text/plain"}},
+						Mode:    changeresponse.ModePrepend,
+						Body:    "Everything is fine\n",
+					}},
+				},
+				responseCode: 500,
+				responseBody: "Some error",
+			},
+			maxAllocs: 6,
+		},
+		{
+			input: inputDataset{
+				name: "no match",
+				config: changeresponse.Config{
+					Overrides: []changeresponse.Override{{From: []int{503}, To: 200}},
+				},
+				responseCode: 500,
+				responseBody: "Some error",
+			},
+			maxAllocs: 4,
+		},
+	}
+
+	for _, d := range datasets {
+		t.Run(d.input.name, func(t *testing.T) {
+			handler := newPluginHandler(t, d.input)
+			rw := &benchResponseWriter{header: http.Header{}}
+			req := httptest.NewRequest(http.MethodGet, "http://localhost", nil)
+
+			allocs := testing.AllocsPerRun(100, func() {
+				rw.reset()
+				handler.ServeHTTP(rw, req)
+			})
+
+			if allocs > d.maxAllocs {
+				t.Errorf("Too many allocations per request: got %v, want at most %v", allocs, d.maxAllocs)
+			}
 		})
 	}
 }
 
+// benchResponseWriter is a reusable response writer discarding body
+type benchResponseWriter struct {
+	header http.Header
+	status int
+}
+
+func (rw *benchResponseWriter) Header() http.Header {
+	return rw.header
+}
+
+func (rw *benchResponseWriter) WriteHeader(statusCode int) {
+	rw.status = statusCode
+}
+
+func (rw *benchResponseWriter) Write(data []byte) (int, error) {
+	return len(data), nil
+}
+
+func (rw *benchResponseWriter) reset() {
+	clear(rw.header)
+	rw.status = 0
+}
+
 func servePlugin(t fatalNotifier, d inputDataset) *httptest.ResponseRecorder {
 	ctx := context.Background()
+	handler := newPluginHandler(t, d)
+
+	recorder := httptest.NewRecorder()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://localhost", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handler.ServeHTTP(recorder, req)
+
+	return recorder
+}
+
+// newPluginHandler creates plugin with backend responding as defined in dataset
+func newPluginHandler(t fatalNotifier, d inputDataset) http.Handler {
 	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
 		rw.WriteHeader(d.responseCode)
 		for k, v := range d.responseHeaders {
@@ -604,21 +816,12 @@ func servePlugin(t fatalNotifier, d inputDataset) *httptest.ResponseRecorder {
 		}
 	})
 
-	handler, err := changeresponse.New(ctx, next, &d.config, "test-plugin")
+	handler, err := changeresponse.New(context.Background(), next, &d.config, "test-plugin")
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	recorder := httptest.NewRecorder()
-
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://localhost", nil)
-	if err != nil {
-		t.Fatal(err)
-	}
-
-	handler.ServeHTTP(recorder, req)
-
-	return recorder
+	return handler
 }
 
 func assertHeadersEqual(t *testing.T, name string, actual http.Header, expected http.Header) {
@@ -649,14 +852,8 @@ func TestNew(t *testing.T) {
 	ctx := context.Background()
 	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {})
 	outBuf := bytes.NewBuffer([]byte{})
-	changeresponse.Notify = func(msg string) {
-		outBuf.WriteString(msg)
-	}
-
 	errBuf := bytes.NewBuffer([]byte{})
-	changeresponse.Alert = func(msg string) {
-		errBuf.WriteString(msg)
-	}
+	captureLogs(t, outBuf, errBuf)
 
 	// Test 1. Check missing override rules
 	config := changeresponse.CreateConfig()
@@ -672,13 +869,29 @@ func TestNew(t *testing.T) {
 		t.Error("Unexpected response when initializing new plugin without config")
 	}
 
-	// Test 3. Debug message with successful init
+	// Test 3. Status code out of range
+	config = &changeresponse.Config{
+		Overrides: []changeresponse.Override{{
+			From: []int{200, 1000},
+			To:   200,
+		}},
+	}
+
+	if _, err := changeresponse.New(ctx, next, config, "test-plugin"); err == nil || err.Error() != "override 0: invalid status code: 1000" {
+		t.Log(err)
+		t.Error("Unexpected response when initializing new plugin with invalid status code")
+	}
+
+	// Test 4. Debug message with successful init
 	config = &changeresponse.Config{
 		Overrides: []changeresponse.Override{{
 			From: []int{200},
 			To:   200,
 		}},
-		Debug: true,
+		Debug:       true,
+		DebugSecret: "debug-s3cret",
+		Fault:       &changeresponse.Fault{Percentage: 100, Header: "X-Chaos", Secret: "fault-s3cret", Delay: "1ms"},
+		Signing:     &changeresponse.Signing{Keys: []changeresponse.SigningKey{{ID: "k1", Secret: "signing-s3cret"}}},
 	}
 
 	outBuf.Reset()
@@ -686,11 +899,31 @@ func TestNew(t *testing.T) {
 		t.Error("Unexpected error: " + err.Error())
 	}
 
-	if !strings.Contains(outBuf.String(), "defined config test-plugin:") {
+	for _, secret := range []string{"debug-s3cret", "fault-s3cret", "signing-s3cret"} {
+		if strings.Contains(outBuf.String(), secret) {
+			t.Errorf("Secret %s must be redacted in logged config: %s", secret, outBuf.String())
+		}
+	}
+
+	if config.Signing.Keys[0].Secret != "signing-s3cret" {
+		t.Errorf("Redaction must not modify the config: %s", config.Signing.Keys[0].Secret)
+	}
+
+	if !strings.Contains(outBuf.String(), `"plugin":"test-plugin","msg":"defined config"`) {
 		t.Errorf(
 			"Unexpected notification\nactual: %s\nexpected: %s",
 			outBuf.String(),
-			"defined config test-plugin:",
+			`"plugin":"test-plugin","msg":"defined config"`,
 		)
 	}
 }
+
+// captureLogs redirects plugin log records to the buffers until the test ends
+func captureLogs(t *testing.T, out io.Writer, errOut io.Writer) {
+	prevOut, prevErrOut := changeresponse.LogOutput, changeresponse.LogErrorOutput
+	changeresponse.LogOutput, changeresponse.LogErrorOutput = out, errOut
+
+	t.Cleanup(func() {
+		changeresponse.LogOutput, changeresponse.LogErrorOutput = prevOut, prevErrOut
+	})
+}
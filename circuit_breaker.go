@@ -0,0 +1,332 @@
+package traefik_change_response
+
+import (
+	"bytes"
+	"container/list"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Circuit breaker states
+const (
+	CircuitClosed   = "closed"
+	CircuitOpen     = "open"
+	CircuitHalfOpen = "half-open"
+)
+
+// Circuit breaker state keys
+const (
+	CircuitKeyHost   = "host"
+	CircuitKeyGlobal = "global"
+)
+
+const (
+	defaultCircuitWindow   = 20
+	defaultCircuitCooldown = 10 * time.Second
+	defaultCircuitMaxKeys  = 10000
+)
+
+// CircuitBreaker stops calling the backend for a cooldown period when it keeps failing
+type CircuitBreaker struct {
+	// Threshold error rate within the window to trip the breaker, 0 < threshold <= 1. Required
+	Threshold float64 `json:"threshold"`
+
+	// Window number of the latest responses to calculate error rate from. Optional, default 20
+	Window int `json:"window,omitempty"`
+
+	// MinRequests number of responses to observe in the window before the breaker may trip. Optional,
+	// defaults to the window size
+	MinRequests int `json:"minRequests,omitempty"`
+
+	// ErrorStatuses list of HTTP status codes counted as failures. Optional, defaults to all 5xx codes
+	ErrorStatuses []int `json:"errorStatuses,omitempty"`
+
+	// Cooldown duration for the breaker to stay open before letting probe requests through. Optional, default 10s
+	Cooldown string `json:"cooldown,omitempty"`
+
+	// Probes number of successful probe requests in half-open state to close the breaker. Optional, default 1
+	Probes int `json:"probes,omitempty"`
+
+	// Key how breaker state is shared between requests. Optional
+	// Allowed:
+	//   host (default) - separate state per request host
+	//   global - single state per plugin instance
+	Key string `json:"key,omitempty"`
+
+	// MaxKeys max number of breaker states kept per plugin instance, the least recently used ones are forgotten.
+	// Optional, default 10000
+	MaxKeys int `json:"maxKeys,omitempty"`
+
+	// Status code to return while the breaker is open. Optional, default 503
+	Status int `json:"status,omitempty"`
+
+	// Headers sets defined headers in fast failure responses. Retry-After is set if not defined. Optional
+	Headers http.Header `json:"headers,omitempty"`
+
+	// Body contents of fast failure responses. Optional
+	Body string `json:"body,omitempty"`
+}
+
+// circuitBreakers keeps breaker states per key
+type circuitBreakers struct {
+	config   *CircuitBreaker
+	cooldown time.Duration
+
+	mu     sync.Mutex
+	states map[string]*list.Element // elements of recent list
+	recent *list.List               // states from the most to the least recently used
+}
+
+// circuitState is a single breaker state machine
+type circuitState struct {
+	key      string
+	state    string
+	outcomes []bool // ring buffer of the latest outcomes, true for failures
+	pos      int
+	count    int
+	failures int
+	openedAt time.Time
+	inFlight int // probe requests being processed in half-open state
+	passed   int // successful probes in half-open state
+}
+
+// newCircuitBreakers validates breaker configuration and sets defaults
+func newCircuitBreakers(config *CircuitBreaker) (*circuitBreakers, error) {
+	if config.Threshold <= 0 || config.Threshold > 1 {
+		return nil, fmt.Errorf("circuit breaker threshold must be within (0, 1]: %v", config.Threshold)
+	}
+
+	if config.Window < 0 || config.MinRequests < 0 || config.Probes < 0 || config.MaxKeys < 0 {
+		return nil, fmt.Errorf("circuit breaker window, minRequests, probes and maxKeys must not be negative")
+	}
+
+	if config.MaxKeys == 0 {
+		config.MaxKeys = defaultCircuitMaxKeys
+	}
+
+	if config.Window == 0 {
+		config.Window = defaultCircuitWindow
+	}
+
+	if config.MinRequests == 0 || config.MinRequests > config.Window {
+		config.MinRequests = config.Window
+	}
+
+	if config.Probes == 0 {
+		config.Probes = 1
+	}
+
+	if config.Status == 0 {
+		config.Status = http.StatusServiceUnavailable
+	}
+
+	switch config.Key {
+	case CircuitKeyHost, CircuitKeyGlobal:
+	case "":
+		config.Key = CircuitKeyHost
+	default:
+		return nil, fmt.Errorf("unsupported circuit breaker key: %s", config.Key)
+	}
+
+	cooldown := defaultCircuitCooldown
+	if config.Cooldown != "" {
+		var err error
+		if cooldown, err = time.ParseDuration(config.Cooldown); err != nil {
+			return nil, fmt.Errorf("invalid circuit breaker cooldown: %w", err)
+		}
+	}
+
+	return &circuitBreakers{
+		config:   config,
+		cooldown: cooldown,
+		states:   make(map[string]*list.Element),
+		recent:   list.New(),
+	}, nil
+}
+
+// key returns breaker state key for the request
+func (cb *circuitBreakers) key(req *http.Request) string {
+	if cb.config.Key == CircuitKeyGlobal {
+		return ""
+	}
+
+	return req.Host
+}
+
+// get returns breaker state for the key. Must be called with locked mutex
+func (cb *circuitBreakers) get(key string) *circuitState {
+	if e, ok := cb.states[key]; ok {
+		cb.recent.MoveToFront(e)
+
+		return e.Value.(*circuitState)
+	}
+
+	s := &circuitState{key: key, state: CircuitClosed, outcomes: make([]bool, cb.config.Window)}
+	cb.states[key] = cb.recent.PushFront(s)
+
+	if cb.recent.Len() > cb.config.MaxKeys { // keys come from requests, so their number must be bounded
+		oldest := cb.recent.Remove(cb.recent.Back()).(*circuitState)
+		delete(cb.states, oldest.key)
+	}
+
+	return s
+}
+
+// allow checks if request may be passed to the backend. Returns the state request was admitted in
+// or time left until the next probe if request was rejected
+func (cb *circuitBreakers) allow(key string) (state string, ok bool, retryAfter time.Duration) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	s := cb.get(key)
+
+	if s.state == CircuitOpen {
+		if elapsed := time.Since(s.openedAt); elapsed < cb.cooldown {
+			return s.state, false, cb.cooldown - elapsed
+		}
+
+		s.state = CircuitHalfOpen
+		s.inFlight = 0
+		s.passed = 0
+	}
+
+	if s.state == CircuitHalfOpen {
+		if s.inFlight+s.passed >= cb.config.Probes {
+			return s.state, false, cb.cooldown
+		}
+
+		s.inFlight++
+	}
+
+	return s.state, true, 0
+}
+
+// record registers response status for the request admitted in the given state. Returns current breaker state
+func (cb *circuitBreakers) record(key string, admitted string, status int) string {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	s := cb.get(key)
+	if s.state != admitted {
+		return s.state // outcome of a request from the previous state period
+	}
+
+	failed := cb.isFailure(status)
+
+	switch s.state {
+	case CircuitClosed:
+		if s.count == len(s.outcomes) {
+			if s.outcomes[s.pos] {
+				s.failures--
+			}
+		} else {
+			s.count++
+		}
+
+		s.outcomes[s.pos] = failed
+		s.pos = (s.pos + 1) % len(s.outcomes)
+
+		if failed {
+			s.failures++
+		}
+
+		if s.count >= cb.config.MinRequests && float64(s.failures)/float64(s.count) >= cb.config.Threshold {
+			s.trip()
+		}
+	case CircuitHalfOpen:
+		s.inFlight--
+
+		if failed {
+			s.trip()
+		} else if s.passed++; s.passed >= cb.config.Probes {
+			s.reset()
+		}
+	}
+
+	return s.state
+}
+
+// release frees probe slot of the request admitted in the given state which response was not recorded, e.g. because
+// the handler panicked
+func (cb *circuitBreakers) release(key string, admitted string) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	e, ok := cb.states[key]
+	if !ok {
+		return
+	}
+
+	if s := e.Value.(*circuitState); admitted == CircuitHalfOpen && s.state == CircuitHalfOpen && s.inFlight > 0 {
+		s.inFlight--
+	}
+}
+
+// isFailure checks if status code is counted as backend failure
+func (cb *circuitBreakers) isFailure(status int) bool {
+	if len(cb.config.ErrorStatuses) == 0 {
+		return status >= 500 && status < 600
+	}
+
+	for _, code := range cb.config.ErrorStatuses {
+		if code == status {
+			return true
+		}
+	}
+
+	return false
+}
+
+// reject prepares fast failure response, headers are set in the given response headers
+func (cb *circuitBreakers) reject(headers http.Header, retryAfter time.Duration) *responseState {
+	for k, hv := range cb.config.Headers {
+		headers.Del(k)
+
+		for _, h := range hv {
+			headers.Add(k, h)
+		}
+	}
+
+	if headers.Get("Retry-After") == "" {
+		headers.Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	}
+
+	headers.Set("Content-Length", strconv.Itoa(len(cb.config.Body)))
+
+	return &responseState{status: cb.config.Status, headers: headers, body: bytes.NewBufferString(cb.config.Body)}
+}
+
+// trip opens the breaker
+func (s *circuitState) trip() {
+	s.state = CircuitOpen
+	s.openedAt = time.Now()
+	s.clear()
+}
+
+// reset closes the breaker
+func (s *circuitState) reset() {
+	s.state = CircuitClosed
+	s.clear()
+}
+
+// clear forgets observed outcomes
+func (s *circuitState) clear() {
+	for i := range s.outcomes {
+		s.outcomes[i] = false
+	}
+
+	s.pos = 0
+	s.count = 0
+	s.failures = 0
+	s.inFlight = 0
+	s.passed = 0
+}
+
+// circuitDebugHeader formats breaker state for the debug header
+func circuitDebugHeader(state string, key string) string {
+	return fmt.Sprintf("state=%s key=%s", state, key)
+}
@@ -0,0 +1,233 @@
+package traefik_change_response_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	changeresponse "github.com/bravepickle/traefik-change-response"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	ctx := context.Background()
+
+	var calls atomic.Int32
+	var status atomic.Int32
+	status.Store(http.StatusBadGateway)
+
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		calls.Add(1)
+		rw.WriteHeader(int(status.Load()))
+	})
+
+	config := &changeresponse.Config{
+		Overrides: []changeresponse.Override{{From: []int{502}, To: 500}},
+		CircuitBreaker: &changeresponse.CircuitBreaker{
+			Threshold: 0.5,
+			Window:    4,
+			Cooldown:  "50ms",
+			Headers:   http.Header{"Content-Type": []string{"text/plain"}},
+			Body:      "backend is down",
+		},
+		Debug: true,
+	}
+
+	handler, err := changeresponse.New(ctx, next, config, "test-plugin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	serve := func(host string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "http://"+host, nil)
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, req)
+
+		return recorder
+	}
+
+	// Step 1. Failures within the window trip the breaker
+	for i := 0; i < 4; i++ {
+		if rec := serve("foo.local"); rec.Code != http.StatusInternalServerError {
+			t.Fatalf("Status code mismatch: got %d, want %d", rec.Code, http.StatusInternalServerError)
+		}
+	}
+
+	if calls.Load() != 4 {
+		t.Fatalf("Backend calls mismatch: got %d, want %d", calls.Load(), 4)
+	}
+
+	// Step 2. Open breaker returns fast failures
+	rec := serve("foo.local")
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Status code mismatch: got %d, want %d", rec.Code, http.StatusServiceUnavailable)
+	}
+
+	if rec.Body.String() != "backend is down" {
+		t.Errorf("Body mismatch\nactual:   %s\nexpected: %s", rec.Body.String(), "backend is down")
+	}
+
+	if rec.Header().Get("Retry-After") != "1" {
+		t.Errorf("Retry-After mismatch: got %q, want %q", rec.Header().Get("Retry-After"), "1")
+	}
+
+	if rec.Header().Get("X-Circuit-Breaker") != "state=open key=foo.local" {
+		t.Errorf("Debug header mismatch: got %q", rec.Header().Get("X-Circuit-Breaker"))
+	}
+
+	if calls.Load() != 4 {
+		t.Errorf("Backend must not be called while breaker is open: got %d calls", calls.Load())
+	}
+
+	// Step 3. Other hosts are not affected
+	if rec := serve("bar.local"); rec.Code != http.StatusInternalServerError {
+		t.Errorf("Status code mismatch for another host: got %d, want %d", rec.Code, http.StatusInternalServerError)
+	}
+
+	// Step 4. Failed probe opens the breaker again
+	time.Sleep(60 * time.Millisecond)
+
+	if rec := serve("foo.local"); rec.Code != http.StatusInternalServerError {
+		t.Errorf("Probe status code mismatch: got %d, want %d", rec.Code, http.StatusInternalServerError)
+	}
+
+	if rec := serve("foo.local"); rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Status code mismatch after failed probe: got %d, want %d", rec.Code, http.StatusServiceUnavailable)
+	}
+
+	// Step 5. Successful probe closes the breaker
+	time.Sleep(60 * time.Millisecond)
+	status.Store(http.StatusOK)
+
+	rec = serve("foo.local")
+	if rec.Code != http.StatusOK {
+		t.Errorf("Probe status code mismatch: got %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	if rec.Header().Get("X-Circuit-Breaker") != "state=closed key=foo.local" {
+		t.Errorf("Debug header mismatch: got %q", rec.Header().Get("X-Circuit-Breaker"))
+	}
+
+	if rec := serve("foo.local"); rec.Code != http.StatusOK {
+		t.Errorf("Status code mismatch after recovery: got %d, want %d", rec.Code, http.StatusOK)
+	}
+}
+
+func TestCircuitBreakerMaxKeys(t *testing.T) {
+	ctx := context.Background()
+
+	var calls atomic.Int32
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		calls.Add(1)
+		rw.WriteHeader(http.StatusBadGateway)
+	})
+
+	config := &changeresponse.Config{
+		Overrides:      []changeresponse.Override{{From: []int{502}, To: 500}},
+		CircuitBreaker: &changeresponse.CircuitBreaker{Threshold: 1, Window: 1, Cooldown: "1h", MaxKeys: 2},
+	}
+
+	handler, err := changeresponse.New(ctx, next, config, "test-plugin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	serve := func(host string) int {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "http://"+host, nil))
+
+		return recorder.Code
+	}
+
+	serve("foo.local") // trips the breaker
+	if code := serve("foo.local"); code != http.StatusServiceUnavailable {
+		t.Fatalf("Status code mismatch: got %d, want %d", code, http.StatusServiceUnavailable)
+	}
+
+	serve("bar.local")
+	serve("baz.local") // evicts the least recently used state of foo.local
+
+	calls.Store(0)
+	if code := serve("foo.local"); code != http.StatusInternalServerError {
+		t.Errorf("Status code mismatch for evicted host: got %d, want %d", code, http.StatusInternalServerError)
+	}
+
+	if calls.Load() != 1 {
+		t.Errorf("Backend calls mismatch: got %d, want %d", calls.Load(), 1)
+	}
+}
+
+func TestCircuitBreakerProbePanic(t *testing.T) {
+	ctx := context.Background()
+
+	var panics atomic.Bool
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if panics.Load() {
+			panic(http.ErrAbortHandler)
+		}
+
+		rw.WriteHeader(http.StatusBadGateway)
+	})
+
+	config := &changeresponse.Config{
+		Overrides:      []changeresponse.Override{{From: []int{502}, To: 500}},
+		CircuitBreaker: &changeresponse.CircuitBreaker{Threshold: 1, Window: 1, Cooldown: "50ms"},
+	}
+
+	handler, err := changeresponse.New(ctx, next, config, "test-plugin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	serve := func() (code int) {
+		defer func() {
+			if recover() != nil {
+				code = -1
+			}
+		}()
+
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "http://foo.local", nil))
+
+		return recorder.Code
+	}
+
+	serve() // trips the breaker
+	time.Sleep(60 * time.Millisecond)
+
+	panics.Store(true)
+	if code := serve(); code != -1 {
+		t.Fatalf("Probe must reach the panicking backend: got status %d", code)
+	}
+
+	panics.Store(false)
+	if code := serve(); code != http.StatusInternalServerError {
+		t.Errorf("Probe of panicked request must be released: got %d, want %d", code, http.StatusInternalServerError)
+	}
+}
+
+func TestCircuitBreakerConfig(t *testing.T) {
+	ctx := context.Background()
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {})
+
+	datasets := map[string]changeresponse.CircuitBreaker{
+		"missing threshold": {},
+		"invalid threshold": {Threshold: 1.5},
+		"invalid cooldown":  {Threshold: 0.5, Cooldown: "soon"},
+		"invalid key":       {Threshold: 0.5, Key: "path"},
+		"negative max keys": {Threshold: 0.5, MaxKeys: -1},
+	}
+
+	for name, breaker := range datasets {
+		config := &changeresponse.Config{
+			Overrides:      []changeresponse.Override{{From: []int{500}, To: 200}},
+			CircuitBreaker: &breaker,
+		}
+
+		if _, err := changeresponse.New(ctx, next, config, "test-plugin"); err == nil {
+			t.Errorf("%s: expected configuration error", name)
+		}
+	}
+}
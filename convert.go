@@ -0,0 +1,436 @@
+package traefik_change_response
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Body formats
+const (
+	FormatJSON = "json"
+	FormatXML  = "xml"
+	FormatForm = "form"
+)
+
+// Array handling in XML
+const (
+	ArraysWrap   = "wrap"
+	ArraysRepeat = "repeat"
+)
+
+var formatContentTypes = map[string]string{
+	FormatJSON: "application/json",
+	FormatXML:  "application/xml",
+	FormatForm: "application/x-www-form-urlencoded",
+}
+
+// xmlNamePattern matches XML element names allowed in configuration
+var xmlNamePattern = regexp.MustCompile(`^[A-Za-z_][\w.\-]*(:[A-Za-z_][\w.\-]*)?$`)
+
+// Convert converts body to another format. Source format is detected by Content-Type. Supported conversions are JSON
+// to XML or form and XML or form to JSON
+type Convert struct {
+	// To target format: json, xml or form. Required
+	To string `json:"to"`
+
+	// Root name of XML document element. Optional, default root
+	Root string `json:"root,omitempty"`
+
+	// Item name of XML elements of array items. Optional, default item
+	Item string `json:"item,omitempty"`
+
+	// Arrays handling in XML. Optional
+	// Allowed:
+	//   wrap (default) - array is an element with item elements
+	//   repeat - array items are elements repeating the array name
+	Arrays string `json:"arrays,omitempty"`
+}
+
+// validateConvert validates body conversion and sets defaults
+func validateConvert(c *Convert) error {
+	if _, ok := formatContentTypes[c.To]; !ok {
+		return fmt.Errorf("unsupported format: %s", c.To)
+	}
+
+	if c.Root == "" {
+		c.Root = "root"
+	}
+
+	if c.Item == "" {
+		c.Item = "item"
+	}
+
+	for _, name := range []string{c.Root, c.Item} {
+		if !xmlNamePattern.MatchString(name) {
+			return fmt.Errorf("invalid element name: %s", name)
+		}
+	}
+
+	switch c.Arrays {
+	case "":
+		c.Arrays = ArraysWrap
+	case ArraysWrap, ArraysRepeat:
+	default:
+		return fmt.Errorf("unsupported arrays handling: %s", c.Arrays)
+	}
+
+	return nil
+}
+
+// convertBody converts body to the target format and updates Content-Type. Returns false if the body is not in
+// a convertible format
+func (s *responseState) convertBody(c *Convert) bool {
+	if s.spill != nil {
+		return false // spilled bodies are not parsed
+	}
+
+	var converted bytes.Buffer
+	var err error
+
+	switch from := bodyFormat(s); {
+	case from == FormatJSON && c.To == FormatXML:
+		err = jsonToXML(&converted, s.body.Bytes(), c)
+	case from == FormatJSON && c.To == FormatForm:
+		err = jsonToForm(&converted, s.body.Bytes())
+	case from == FormatXML && c.To == FormatJSON:
+		err = xmlToJSON(&converted, s.body.Bytes(), c)
+	case from == FormatForm && c.To == FormatJSON:
+		err = formToJSON(&converted, s.body.Bytes())
+	default:
+		return false
+	}
+
+	if err != nil {
+		return false
+	}
+
+	s.body.Reset()
+	s.body.Write(converted.Bytes())
+	s.headers.Set("Content-Type", formatContentTypes[c.To])
+
+	return true
+}
+
+// bodyFormat detects body format by Content-Type or, if it is missing, by the body contents
+func bodyFormat(s *responseState) string {
+	if encoding := s.headers.Get("Content-Encoding"); encoding != "" && !strings.EqualFold(encoding, "identity") {
+		return ""
+	}
+
+	contentType := s.headers.Get("Content-Type")
+	if contentType == "" {
+		switch body := bytes.TrimSpace(s.body.Bytes()); {
+		case len(body) == 0:
+			return ""
+		case body[0] == '{' || body[0] == '[':
+			return FormatJSON
+		case body[0] == '<':
+			return FormatXML
+		}
+
+		return ""
+	}
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return ""
+	}
+
+	switch {
+	case mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"):
+		return FormatJSON
+	case mediaType == "application/xml" || mediaType == "text/xml" || strings.HasSuffix(mediaType, "+xml"):
+		return FormatXML
+	case mediaType == "application/x-www-form-urlencoded":
+		return FormatForm
+	}
+
+	return ""
+}
+
+// jsonToXML converts JSON document to XML keeping order of object fields
+func jsonToXML(b *bytes.Buffer, data []byte, c *Convert) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8"?>`)
+
+	if err := writeJSONElement(b, decoder, c.Root, false, c); err != nil {
+		return err
+	}
+
+	if _, err := decoder.Token(); !errors.Is(err, io.EOF) {
+		return fmt.Errorf("unexpected data after JSON document")
+	}
+
+	return nil
+}
+
+// writeJSONElement writes the next JSON value as an element. Arrays repeat the element if repeatable is set
+func writeJSONElement(b *bytes.Buffer, decoder *json.Decoder, name string, repeatable bool, c *Convert) error {
+	t, err := decoder.Token()
+	if err != nil {
+		return err
+	}
+
+	switch v := t.(type) {
+	case json.Delim:
+		if v == '[' && repeatable && c.Arrays == ArraysRepeat {
+			for decoder.More() {
+				if err := writeJSONElement(b, decoder, name, false, c); err != nil {
+					return err
+				}
+			}
+
+			_, err = decoder.Token()
+
+			return err
+		}
+
+		b.WriteString("<" + name + ">")
+
+		for decoder.More() {
+			itemName := c.Item
+			if v == '{' {
+				key, err := decoder.Token()
+				if err != nil {
+					return err
+				}
+
+				itemName = xmlElementName(key.(string))
+			}
+
+			if err := writeJSONElement(b, decoder, itemName, v == '{', c); err != nil {
+				return err
+			}
+		}
+
+		if _, err := decoder.Token(); err != nil {
+			return err
+		}
+
+		b.WriteString("</" + name + ">")
+	case nil:
+		b.WriteString("<" + name + "/>")
+	default:
+		b.WriteString("<" + name + ">")
+		_, _ = xmlTextEscaper.WriteString(b, scalarString(v))
+		b.WriteString("</" + name + ">")
+	}
+
+	return nil
+}
+
+// xmlElementName replaces characters not allowed in XML element names and prefixes names not starting with a letter
+func xmlElementName(key string) string {
+	name := []byte(key)
+	for i, c := range name {
+		if !('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || c == '_' || c == '-' || c == '.') {
+			name[i] = '_'
+		}
+	}
+
+	if len(name) == 0 || !('a' <= name[0] && name[0] <= 'z' || 'A' <= name[0] && name[0] <= 'Z' || name[0] == '_') {
+		return "_" + string(name)
+	}
+
+	return string(name)
+}
+
+// scalarString formats JSON scalar value
+func scalarString(v any) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case bool:
+		return strconv.FormatBool(v)
+	}
+
+	return ""
+}
+
+// jsonToForm converts flat JSON object to form. Array values of the object are added as repeated fields
+func jsonToForm(b *bytes.Buffer, data []byte) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var object map[string]any
+	if err := decoder.Decode(&object); err != nil {
+		return err
+	}
+
+	values := url.Values{}
+	for key, value := range object {
+		items, ok := value.([]any)
+		if !ok {
+			items = []any{value}
+		}
+
+		for _, item := range items {
+			switch item.(type) {
+			case map[string]any, []any:
+				return fmt.Errorf("not a flat object")
+			}
+
+			values.Add(key, scalarString(item))
+		}
+	}
+
+	b.WriteString(values.Encode())
+
+	return nil
+}
+
+// formToJSON converts form to JSON object. Repeated fields become arrays
+func formToJSON(b *bytes.Buffer, data []byte) error {
+	values, err := url.ParseQuery(string(data))
+	if err != nil {
+		return err
+	}
+
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	object := &jsonObject{values: map[string][]any{}}
+	for _, key := range keys {
+		for _, value := range values[key] {
+			object.add(key, value)
+		}
+	}
+
+	writeJSON(b, object)
+
+	return nil
+}
+
+// jsonObject is a JSON object keeping order of its fields. Fields with multiple values are arrays
+type jsonObject struct {
+	keys   []string
+	values map[string][]any
+}
+
+// add adds value of the field
+func (o *jsonObject) add(key string, value any) {
+	if _, ok := o.values[key]; !ok {
+		o.keys = append(o.keys, key)
+	}
+
+	o.values[key] = append(o.values[key], value)
+}
+
+// xmlToJSON converts XML document to JSON. Document element is omitted, attributes become fields prefixed with @,
+// text of elements with attributes or children becomes #text field
+func xmlToJSON(b *bytes.Buffer, data []byte, c *Convert) error {
+	tokens, err := parseXML(data)
+	if err != nil {
+		return err
+	}
+
+	for i, t := range tokens {
+		if _, ok := t.(xml.StartElement); ok {
+			writeJSON(b, xmlElementValue(tokens[i:elementEnd(tokens, i)+1], c))
+
+			return nil
+		}
+	}
+
+	return nil // unreachable for parsed documents
+}
+
+// xmlElementValue converts tokens of an element to JSON value
+func xmlElementValue(tokens []xml.Token, c *Convert) any {
+	start := tokens[0].(xml.StartElement)
+	object := &jsonObject{values: map[string][]any{}}
+
+	for _, attr := range start.Attr {
+		if attr.Name.Space != "xmlns" && !(attr.Name.Space == "" && attr.Name.Local == "xmlns") {
+			object.add("@"+attr.Name.Local, attr.Value)
+		}
+	}
+
+	var text strings.Builder
+	for i := 1; i < len(tokens)-1; i++ {
+		switch t := tokens[i].(type) {
+		case xml.StartElement:
+			end := elementEnd(tokens, i)
+			object.add(t.Name.Local, xmlElementValue(tokens[i:end+1], c))
+			i = end
+		case xml.CharData:
+			text.Write(t)
+		}
+	}
+
+	contents := strings.TrimSpace(text.String())
+
+	if len(object.keys) == 0 {
+		return contents
+	}
+
+	if c.Arrays == ArraysWrap && len(object.keys) == 1 && object.keys[0] == c.Item && contents == "" {
+		return object.values[c.Item] // array wrapped into the element
+	}
+
+	if contents != "" {
+		object.add("#text", contents)
+	}
+
+	return object
+}
+
+// writeJSON writes JSON value
+func writeJSON(b *bytes.Buffer, value any) {
+	switch v := value.(type) {
+	case *jsonObject:
+		b.WriteByte('{')
+
+		for i, key := range v.keys {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+
+			writeJSON(b, key)
+			b.WriteByte(':')
+
+			if values := v.values[key]; len(values) == 1 {
+				writeJSON(b, values[0])
+			} else {
+				writeJSON(b, values)
+			}
+		}
+
+		b.WriteByte('}')
+	case []any:
+		b.WriteByte('[')
+
+		for i, item := range v {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+
+			writeJSON(b, item)
+		}
+
+		b.WriteByte(']')
+	default:
+		encoder := json.NewEncoder(b)
+		encoder.SetEscapeHTML(false)
+		_ = encoder.Encode(v)
+		b.Truncate(b.Len() - 1) // trailing newline
+	}
+}
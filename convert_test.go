@@ -0,0 +1,180 @@
+package traefik_change_response_test
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"testing"
+
+	changeresponse "github.com/bravepickle/traefik-change-response"
+)
+
+func TestConvert(t *testing.T) {
+	order := `{"id":42,"customer":"Tom & Jerry","paid":true,"note":null,"tags":["new","gift"],` +
+		`"items":[{"sku":"A-1","qty":2}],"1st":"x"}`
+	jsonHeaders := http.Header{"Content-Type": []string{"application/json; charset=utf-8"}}
+	xmlHeaders := http.Header{"Content-Type": []string{"text/xml"}}
+
+	datasets := []struct {
+		name         string
+		convert      changeresponse.Convert
+		mode         string
+		body         string
+		headers      http.Header
+		expectedType string
+		expectedBody string
+	}{
+		{
+			name:         "json to xml",
+			convert:      changeresponse.Convert{To: changeresponse.FormatXML, Root: "order"},
+			body:         order,
+			headers:      jsonHeaders,
+			expectedType: "application/xml",
+			expectedBody: `<?xml version="1.0" encoding="UTF-8"?><order><id>42</id><customer>Tom &amp; Jerry</customer>` +
+				`<paid>true</paid><note/><tags><item>new</item><item>gift</item></tags>` +
+				`<items><item><sku>A-1</sku><qty>2</qty></item></items><_1st>x</_1st></order>`,
+		},
+		{
+			name:         "json to xml with repeated arrays",
+			convert:      changeresponse.Convert{To: changeresponse.FormatXML, Arrays: changeresponse.ArraysRepeat},
+			body:         `{"tags":["new","gift"],"matrix":[[1,2]]}`,
+			headers:      jsonHeaders,
+			expectedType: "application/xml",
+			expectedBody: `<?xml version="1.0" encoding="UTF-8"?><root><tags>new</tags><tags>gift</tags>` +
+				`<matrix><item>1</item><item>2</item></matrix></root>`,
+		},
+		{
+			name:         "json array to xml",
+			convert:      changeresponse.Convert{To: changeresponse.FormatXML, Item: "error", Arrays: changeresponse.ArraysRepeat},
+			body:         `["timeout","retry"]`,
+			headers:      jsonHeaders,
+			expectedType: "application/xml",
+			expectedBody: `<?xml version="1.0" encoding="UTF-8"?><root><error>timeout</error><error>retry</error></root>`,
+		},
+		{
+			name:         "xml to json",
+			convert:      changeresponse.Convert{To: changeresponse.FormatJSON},
+			body:         `<order xmlns="urn:shop" id="42"><customer>Tom &amp; Jerry</customer><tags><item>new</item></tags>` + "\n" + `<line sku="A-1">2</line><line sku="B-2">1</line><note/></order>`,
+			headers:      xmlHeaders,
+			expectedType: "application/json",
+			expectedBody: `{"@id":"42","customer":"Tom & Jerry","tags":["new"],` +
+				`"line":[{"@sku":"A-1","#text":"2"},{"@sku":"B-2","#text":"1"}],"note":""}`,
+		},
+		{
+			name:         "json to form",
+			convert:      changeresponse.Convert{To: changeresponse.FormatForm},
+			body:         `{"error":"invalid token","code":401,"retry":false,"scope":["read","write"],"hint":null}`,
+			headers:      jsonHeaders,
+			expectedType: "application/x-www-form-urlencoded",
+			expectedBody: "code=401&error=invalid+token&hint=&retry=false&scope=read&scope=write",
+		},
+		{
+			name:         "nested json to form",
+			convert:      changeresponse.Convert{To: changeresponse.FormatForm},
+			body:         order,
+			headers:      jsonHeaders,
+			expectedType: "application/json; charset=utf-8",
+			expectedBody: order,
+		},
+		{
+			name:         "form to json",
+			convert:      changeresponse.Convert{To: changeresponse.FormatJSON},
+			body:         "scope=read&scope=write&error=invalid+token",
+			headers:      http.Header{"Content-Type": []string{"application/x-www-form-urlencoded"}},
+			expectedType: "application/json",
+			expectedBody: `{"error":"invalid token","scope":["read","write"]}`,
+		},
+		{
+			name:         "replaced body detected by contents",
+			convert:      changeresponse.Convert{To: changeresponse.FormatXML, Root: "error"},
+			mode:         changeresponse.ModeReplace,
+			body:         "Some error",
+			expectedType: "application/xml",
+			expectedBody: `<?xml version="1.0" encoding="UTF-8"?><error><message>unavailable</message></error>`,
+		},
+		{
+			name:         "invalid json",
+			convert:      changeresponse.Convert{To: changeresponse.FormatXML},
+			body:         `{"id":42`,
+			headers:      jsonHeaders,
+			expectedType: "application/json; charset=utf-8",
+			expectedBody: `{"id":42`,
+		},
+	}
+
+	for _, d := range datasets {
+		t.Run(d.name, func(t *testing.T) {
+			mode := d.mode
+			if mode == "" {
+				mode = changeresponse.ModeKeep
+			}
+
+			convert := d.convert
+			recorder := servePlugin(t, inputDataset{
+				config: changeresponse.Config{
+					Overrides: []changeresponse.Override{{
+						From:    []int{500},
+						To:      502,
+						Body:    `{"message":"unavailable"}`,
+						Mode:    mode,
+						Convert: &convert,
+					}},
+				},
+				responseCode:    http.StatusInternalServerError,
+				responseHeaders: d.headers,
+				responseBody:    d.body,
+			})
+
+			if actual := recorder.Header().Get("Content-Type"); actual != d.expectedType {
+				t.Errorf("Content-Type mismatch: got %q, want %q", actual, d.expectedType)
+			}
+
+			if actual := recorder.Body.String(); actual != d.expectedBody {
+				t.Errorf("Body mismatch\nactual:   %s\nexpected: %s", actual, d.expectedBody)
+			}
+
+			if actual := recorder.Header().Get("Content-Length"); actual != strconv.Itoa(len(d.expectedBody)) {
+				t.Errorf("Content-Length mismatch: got %s, want %d", actual, len(d.expectedBody))
+			}
+		})
+	}
+}
+
+func TestConvertConfig(t *testing.T) {
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {})
+
+	datasets := []struct {
+		name     string
+		convert  changeresponse.Convert
+		expected string
+	}{
+		{
+			name:     "unsupported format",
+			convert:  changeresponse.Convert{To: "yaml"},
+			expected: "override 0: convert: unsupported format: yaml",
+		},
+		{
+			name:     "invalid root",
+			convert:  changeresponse.Convert{To: changeresponse.FormatXML, Root: "1st"},
+			expected: "override 0: convert: invalid element name: 1st",
+		},
+		{
+			name:     "unsupported arrays handling",
+			convert:  changeresponse.Convert{To: changeresponse.FormatXML, Arrays: "flatten"},
+			expected: "override 0: convert: unsupported arrays handling: flatten",
+		},
+	}
+
+	for _, d := range datasets {
+		t.Run(d.name, func(t *testing.T) {
+			config := &changeresponse.Config{
+				Overrides: []changeresponse.Override{{From: []int{500}, To: 200, Convert: &d.convert}},
+			}
+
+			_, err := changeresponse.New(context.Background(), next, config, "test-plugin")
+			if err == nil || err.Error() != d.expected {
+				t.Errorf("Unexpected error\nactual:   %v\nexpected: %s", err, d.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,164 @@
+package traefik_change_response
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// Cookies modifies cookies set by the response. Each Set-Cookie header value is handled separately, so that other
+// cookies are preserved
+type Cookies struct {
+	// Remove names of cookies to drop from the response, supports * and ? wildcards. Optional
+	Remove []string `json:"remove,omitempty" list:"comma"`
+
+	// Names of cookies to modify attributes of, supports * and ? wildcards. Optional, all cookies by default
+	Names []string `json:"names,omitempty" list:"comma"`
+
+	// Secure enforces Secure attribute. Optional
+	Secure bool `json:"secure,omitempty"`
+
+	// HTTPOnly enforces HttpOnly attribute. Optional
+	HTTPOnly bool `json:"httpOnly,omitempty"`
+
+	// SameSite enforces SameSite attribute: lax, strict or none. None also enforces Secure attribute. Optional
+	SameSite string `json:"sameSite,omitempty"`
+
+	// Domain rewrites Domain attribute. Optional
+	Domain string `json:"domain,omitempty"`
+
+	// Path rewrites Path attribute. Optional
+	Path string `json:"path,omitempty"`
+
+	// Add list of cookies to add in Set-Cookie header format, e.g. "error_id={{requestId}}; Path=/; HttpOnly".
+	// Supports {{name}} placeholders. Optional
+	Add []string `json:"add,omitempty"`
+}
+
+// cookieRules are cookie modifications prepared for processing responses
+type cookieRules struct {
+	config   *Cookies
+	remove   *regexp.Regexp // names of cookies to drop
+	names    *regexp.Regexp // names of cookies to modify, nil matches all
+	sameSite http.SameSite
+	modify   bool // cookie attributes are modified
+}
+
+// compileCookies validates cookie modifications
+func compileCookies(config *Cookies) (*cookieRules, error) {
+	c := &cookieRules{
+		config: config,
+		remove: compileGlobs(config.Remove),
+		names:  compileGlobs(config.Names),
+		modify: config.Secure || config.HTTPOnly || config.SameSite != "" || config.Domain != "" || config.Path != "",
+	}
+
+	switch strings.ToLower(config.SameSite) {
+	case "":
+	case "lax":
+		c.sameSite = http.SameSiteLaxMode
+	case "strict":
+		c.sameSite = http.SameSiteStrictMode
+	case "none":
+		c.sameSite = http.SameSiteNoneMode
+	default:
+		return nil, fmt.Errorf("unsupported sameSite: %s", config.SameSite)
+	}
+
+	for _, cookie := range config.Add {
+		if len(parseSetCookie(cookie)) == 0 {
+			return nil, fmt.Errorf("invalid cookie to add: %s", cookie)
+		}
+	}
+
+	return c, nil
+}
+
+// compileGlobs compiles glob patterns with * and ? wildcards into a single regular expression. Returns nil if there
+// are no patterns
+func compileGlobs(globs []string) *regexp.Regexp {
+	if len(globs) == 0 {
+		return nil
+	}
+
+	patterns := make([]string, len(globs))
+	for i, glob := range globs {
+		patterns[i] = globPattern(glob)
+	}
+
+	return regexp.MustCompile(strings.Join(patterns, "|")) // quoted patterns are always valid
+}
+
+// apply modifies Set-Cookie headers
+func (c *cookieRules) apply(headers http.Header, vars *templateVars) {
+	values := headers["Set-Cookie"]
+	if len(values) == 0 && len(c.config.Add) == 0 {
+		return
+	}
+
+	modified := make([]string, 0, len(values)+len(c.config.Add))
+
+	for _, value := range values {
+		cookies := parseSetCookie(value)
+		if len(cookies) == 0 {
+			modified = append(modified, value) // keep values net/http can not parse as they are
+
+			continue
+		}
+
+		cookie := cookies[0]
+
+		if c.remove != nil && c.remove.MatchString(cookie.Name) {
+			continue
+		}
+
+		if c.modify && (c.names == nil || c.names.MatchString(cookie.Name)) {
+			c.modifyCookie(cookie)
+
+			if serialized := cookie.String(); serialized != "" {
+				value = serialized
+			}
+		}
+
+		modified = append(modified, value)
+	}
+
+	for _, cookie := range c.config.Add {
+		modified = append(modified, renderTemplate(cookie, vars, nil))
+	}
+
+	if len(modified) == 0 {
+		delete(headers, "Set-Cookie")
+	} else {
+		headers["Set-Cookie"] = modified
+	}
+}
+
+// modifyCookie enforces cookie attributes
+func (c *cookieRules) modifyCookie(cookie *http.Cookie) {
+	if c.config.Secure || c.sameSite == http.SameSiteNoneMode {
+		cookie.Secure = true
+	}
+
+	if c.config.HTTPOnly {
+		cookie.HttpOnly = true
+	}
+
+	if c.sameSite != 0 {
+		cookie.SameSite = c.sameSite
+	}
+
+	if c.config.Domain != "" {
+		cookie.Domain = c.config.Domain
+	}
+
+	if c.config.Path != "" {
+		cookie.Path = c.config.Path
+	}
+}
+
+// parseSetCookie parses Set-Cookie header value
+func parseSetCookie(value string) []*http.Cookie {
+	return (&http.Response{Header: http.Header{"Set-Cookie": []string{value}}}).Cookies()
+}
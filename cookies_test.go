@@ -0,0 +1,128 @@
+package traefik_change_response_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	changeresponse "github.com/bravepickle/traefik-change-response"
+)
+
+func TestCookies(t *testing.T) {
+	datasets := []struct {
+		name     string
+		cookies  changeresponse.Cookies
+		headers  http.Header
+		expected []string
+	}{
+		{
+			name: "remove and enforce attributes",
+			cookies: changeresponse.Cookies{
+				Remove:   []string{"session*"},
+				Names:    []string{"theme", "lang"},
+				Secure:   true,
+				HTTPOnly: true,
+				SameSite: "Lax",
+				Domain:   "example.com",
+				Path:     "/app",
+			},
+			headers: http.Header{
+				"Set-Cookie": []string{
+					"session_id=abc; Path=/; HttpOnly",
+					"theme=dark; Path=/; Max-Age=3600",
+					"tracking=1; Path=/",
+				},
+			},
+			expected: []string{
+				"theme=dark; Path=/app; Domain=example.com; Max-Age=3600; HttpOnly; Secure; SameSite=Lax",
+				"tracking=1; Path=/",
+			},
+		},
+		{
+			name:    "same site none",
+			cookies: changeresponse.Cookies{SameSite: "none"},
+			headers: http.Header{"Set-Cookie": []string{"theme=dark"}},
+			expected: []string{
+				"theme=dark; Secure; SameSite=None",
+			},
+		},
+		{
+			name:    "add",
+			cookies: changeresponse.Cookies{Add: []string{"error_method={{method}}; Path=/; HttpOnly"}},
+			headers: http.Header{"Set-Cookie": []string{"theme=dark", "invalid"}},
+			expected: []string{
+				"theme=dark",
+				"invalid",
+				"error_method=GET; Path=/; HttpOnly",
+			},
+		},
+		{
+			name:     "remove all",
+			cookies:  changeresponse.Cookies{Remove: []string{"*"}},
+			headers:  http.Header{"Set-Cookie": []string{"theme=dark", "session_id=abc"}},
+			expected: nil,
+		},
+	}
+
+	for _, d := range datasets {
+		t.Run(d.name, func(t *testing.T) {
+			recorder := servePlugin(t, inputDataset{
+				config: changeresponse.Config{
+					Overrides: []changeresponse.Override{{
+						From:    []int{500},
+						To:      500,
+						Headers: http.Header{"X-Foo": []string{"bar"}},
+						Cookies: &d.cookies,
+					}},
+				},
+				responseCode:    http.StatusInternalServerError,
+				responseHeaders: d.headers,
+			})
+
+			actual := recorder.Header().Values("Set-Cookie")
+			if len(actual) != len(d.expected) {
+				t.Fatalf("Set-Cookie mismatch\nactual:   %q\nexpected: %q", actual, d.expected)
+			}
+
+			for i := range actual {
+				if actual[i] != d.expected[i] {
+					t.Errorf("Set-Cookie mismatch\nactual:   %q\nexpected: %q", actual, d.expected)
+				}
+			}
+		})
+	}
+}
+
+func TestCookiesConfig(t *testing.T) {
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {})
+
+	datasets := []struct {
+		name     string
+		cookies  changeresponse.Cookies
+		expected string
+	}{
+		{
+			name:     "unsupported same site",
+			cookies:  changeresponse.Cookies{SameSite: "always"},
+			expected: "override 0: cookies: unsupported sameSite: always",
+		},
+		{
+			name:     "invalid cookie",
+			cookies:  changeresponse.Cookies{Add: []string{"; Path=/"}},
+			expected: "override 0: cookies: invalid cookie to add: ; Path=/",
+		},
+	}
+
+	for _, d := range datasets {
+		t.Run(d.name, func(t *testing.T) {
+			config := &changeresponse.Config{
+				Overrides: []changeresponse.Override{{From: []int{500}, To: 200, Cookies: &d.cookies}},
+			}
+
+			_, err := changeresponse.New(context.Background(), next, config, "test-plugin")
+			if err == nil || err.Error() != d.expected {
+				t.Errorf("Unexpected error\nactual:   %v\nexpected: %s", err, d.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,136 @@
+package traefik_change_response
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// CORS sets cross-origin resource sharing headers for allowed request origins, so that browsers can read rewritten
+// responses, e.g. error pages the backend did not add CORS headers to
+type CORS struct {
+	// AllowOrigins list of allowed origins, e.g. https://app.example.com. Supports * and ? wildcards, * allows any
+	// origin. Required
+	AllowOrigins []string `json:"allowOrigins" list:"comma"`
+
+	// AllowCredentials allows requests with credentials. Request origin is reflected instead of *. Optional
+	AllowCredentials bool `json:"allowCredentials,omitempty"`
+
+	// ExposeHeaders list of response headers available to scripts. Optional
+	ExposeHeaders []string `json:"exposeHeaders,omitempty" list:"comma"`
+
+	// AllowMethods list of methods allowed in preflight responses. Optional, requested method by default
+	AllowMethods []string `json:"allowMethods,omitempty" list:"comma"`
+
+	// AllowHeaders list of request headers allowed in preflight responses. Optional, requested headers by default
+	AllowHeaders []string `json:"allowHeaders,omitempty" list:"comma"`
+
+	// MaxAge number of seconds preflight responses may be cached for. Optional
+	MaxAge int `json:"maxAge,omitempty"`
+}
+
+// corsRules are CORS settings prepared for processing responses
+type corsRules struct {
+	config    *CORS
+	origins   *regexp.Regexp
+	anyOrigin bool // any origin is allowed
+
+	exposeHeaders string
+	allowMethods  string
+	allowHeaders  string
+}
+
+// compileCORS validates CORS settings
+func compileCORS(config *CORS) (*corsRules, error) {
+	if len(config.AllowOrigins) == 0 {
+		return nil, fmt.Errorf("at least one allowed origin is required")
+	}
+
+	if config.MaxAge < 0 {
+		return nil, fmt.Errorf("maxAge must not be negative: %d", config.MaxAge)
+	}
+
+	c := &corsRules{
+		config:        config,
+		exposeHeaders: strings.Join(config.ExposeHeaders, ", "),
+		allowMethods:  strings.Join(config.AllowMethods, ", "),
+		allowHeaders:  strings.Join(config.AllowHeaders, ", "),
+	}
+
+	for _, origin := range config.AllowOrigins {
+		if origin == "*" {
+			c.anyOrigin = true
+		}
+	}
+
+	if c.anyOrigin && config.AllowCredentials {
+		return nil, fmt.Errorf("allowCredentials can not be used with any origin *, list allowed origins instead")
+	}
+
+	// origins are compared ignoring case as scheme and host are case-insensitive
+	c.origins = regexp.MustCompile("(?i)" + compileGlobs(config.AllowOrigins).String())
+
+	return c, nil
+}
+
+// apply sets CORS headers for allowed request origin
+func (c *corsRules) apply(headers http.Header, req *http.Request) {
+	if !c.anyOrigin {
+		addVary(headers, "Origin") // response depends on the request origin
+	}
+
+	origin := req.Header.Get("Origin")
+	if origin == "" || !c.origins.MatchString(origin) {
+		return
+	}
+
+	if c.anyOrigin {
+		headers.Set("Access-Control-Allow-Origin", "*")
+	} else {
+		headers.Set("Access-Control-Allow-Origin", origin)
+	}
+
+	if c.config.AllowCredentials {
+		headers.Set("Access-Control-Allow-Credentials", "true")
+	}
+
+	if c.exposeHeaders != "" {
+		headers.Set("Access-Control-Expose-Headers", c.exposeHeaders)
+	}
+
+	method := req.Header.Get("Access-Control-Request-Method")
+	if req.Method != http.MethodOptions || method == "" {
+		return // not a preflight request
+	}
+
+	if c.allowMethods != "" {
+		method = c.allowMethods
+	}
+
+	headers.Set("Access-Control-Allow-Methods", method)
+
+	if allowHeaders := c.allowHeaders; allowHeaders != "" {
+		headers.Set("Access-Control-Allow-Headers", allowHeaders)
+	} else if requested := req.Header.Get("Access-Control-Request-Headers"); requested != "" {
+		headers.Set("Access-Control-Allow-Headers", requested)
+	}
+
+	if c.config.MaxAge > 0 {
+		headers.Set("Access-Control-Max-Age", strconv.Itoa(c.config.MaxAge))
+	}
+}
+
+// addVary adds field name to Vary header unless it is listed already
+func addVary(headers http.Header, name string) {
+	for _, value := range headers["Vary"] {
+		for _, field := range strings.Split(value, ",") {
+			if field = strings.TrimSpace(field); field == "*" || strings.EqualFold(field, name) {
+				return
+			}
+		}
+	}
+
+	headers["Vary"] = append(headers["Vary"], name)
+}
@@ -0,0 +1,197 @@
+package traefik_change_response_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	changeresponse "github.com/bravepickle/traefik-change-response"
+)
+
+func TestCORS(t *testing.T) {
+	datasets := []struct {
+		name         string
+		config       changeresponse.Config
+		method       string
+		reqHeaders   http.Header
+		responseCode int
+		expected     map[string]string
+	}{
+		{
+			name: "allowed origin",
+			config: changeresponse.Config{
+				Overrides: []changeresponse.Override{{
+					From: []int{500},
+					To:   503,
+					CORS: &changeresponse.CORS{
+						AllowOrigins:     []string{"https://app.example.com", "https://admin.example.com"},
+						AllowCredentials: true,
+						ExposeHeaders:    []string{"X-Request-Id", "Retry-After"},
+					},
+				}},
+			},
+			reqHeaders:   http.Header{"Origin": []string{"https://admin.example.com"}},
+			responseCode: http.StatusInternalServerError,
+			expected: map[string]string{
+				"Access-Control-Allow-Origin":      "https://admin.example.com",
+				"Access-Control-Allow-Credentials": "true",
+				"Access-Control-Expose-Headers":    "X-Request-Id, Retry-After",
+				"Vary":                             "Accept-Encoding, Origin",
+			},
+		},
+		{
+			name: "disallowed origin",
+			config: changeresponse.Config{
+				Overrides: []changeresponse.Override{{
+					From: []int{500},
+					To:   503,
+					CORS: &changeresponse.CORS{AllowOrigins: []string{"https://*.example.com"}},
+				}},
+			},
+			reqHeaders:   http.Header{"Origin": []string{"https://example.org"}},
+			responseCode: http.StatusInternalServerError,
+			expected: map[string]string{
+				"Access-Control-Allow-Origin": "",
+				"Vary":                        "Accept-Encoding, Origin",
+			},
+		},
+		{
+			name: "wildcard origin",
+			config: changeresponse.Config{
+				Overrides: []changeresponse.Override{{
+					From: []int{500},
+					To:   503,
+					CORS: &changeresponse.CORS{AllowOrigins: []string{"https://*.example.com"}},
+				}},
+			},
+			reqHeaders:   http.Header{"Origin": []string{"https://App.example.com"}},
+			responseCode: http.StatusInternalServerError,
+			expected: map[string]string{
+				"Access-Control-Allow-Origin": "https://App.example.com",
+			},
+		},
+		{
+			name: "any origin",
+			config: changeresponse.Config{
+				Overrides: []changeresponse.Override{{
+					From: []int{500},
+					To:   503,
+					CORS: &changeresponse.CORS{AllowOrigins: []string{"*"}},
+				}},
+			},
+			reqHeaders:   http.Header{"Origin": []string{"https://example.org"}},
+			responseCode: http.StatusInternalServerError,
+			expected: map[string]string{
+				"Access-Control-Allow-Origin":      "*",
+				"Access-Control-Allow-Credentials": "",
+				"Vary":                             "Accept-Encoding",
+			},
+		},
+		{
+			name: "preflight",
+			config: changeresponse.Config{
+				Overrides: []changeresponse.Override{{
+					From: []int{405},
+					To:   204,
+					CORS: &changeresponse.CORS{AllowOrigins: []string{"*"}, AllowMethods: []string{"GET", "POST"}, MaxAge: 600},
+				}},
+			},
+			method: http.MethodOptions,
+			reqHeaders: http.Header{
+				"Origin":                         []string{"https://example.org"},
+				"Access-Control-Request-Method":  []string{"POST"},
+				"Access-Control-Request-Headers": []string{"Content-Type, X-Token"},
+			},
+			responseCode: http.StatusMethodNotAllowed,
+			expected: map[string]string{
+				"Access-Control-Allow-Origin":  "*",
+				"Access-Control-Allow-Methods": "GET, POST",
+				"Access-Control-Allow-Headers": "Content-Type, X-Token",
+				"Access-Control-Max-Age":       "600",
+			},
+		},
+		{
+			name: "plugin defaults",
+			config: changeresponse.Config{
+				Overrides: []changeresponse.Override{{From: []int{500}, To: 503}},
+				CORS:      &changeresponse.CORS{AllowOrigins: []string{"https://app.example.com"}},
+			},
+			reqHeaders:   http.Header{"Origin": []string{"https://app.example.com"}},
+			responseCode: http.StatusInternalServerError,
+			expected: map[string]string{
+				"Access-Control-Allow-Origin": "https://app.example.com",
+			},
+		},
+		{
+			name: "rule does not match",
+			config: changeresponse.Config{
+				Overrides: []changeresponse.Override{{From: []int{502}, To: 503}},
+				CORS:      &changeresponse.CORS{AllowOrigins: []string{"https://app.example.com"}},
+			},
+			reqHeaders:   http.Header{"Origin": []string{"https://app.example.com"}},
+			responseCode: http.StatusInternalServerError,
+			expected: map[string]string{
+				"Access-Control-Allow-Origin": "",
+				"Vary":                        "Accept-Encoding",
+			},
+		},
+	}
+
+	for _, d := range datasets {
+		t.Run(d.name, func(t *testing.T) {
+			handler := newPluginHandler(t, inputDataset{
+				config:          d.config,
+				responseCode:    d.responseCode,
+				responseHeaders: http.Header{"Vary": []string{"Accept-Encoding"}},
+			})
+
+			method := d.method
+			if method == "" {
+				method = http.MethodGet
+			}
+
+			req := httptest.NewRequest(method, "http://localhost", nil)
+			req.Header = d.reqHeaders
+
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, req)
+
+			for name, expected := range d.expected {
+				if actual := strings.Join(recorder.Header().Values(name), ", "); actual != expected {
+					t.Errorf("%s header mismatch: got %q, want %q", name, actual, expected)
+				}
+			}
+		})
+	}
+}
+
+func TestCORSConfig(t *testing.T) {
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {})
+
+	datasets := map[string]struct {
+		cors     changeresponse.CORS
+		expected string
+	}{
+		"missing origins": {
+			cors:     changeresponse.CORS{AllowCredentials: true},
+			expected: "cors: at least one allowed origin is required",
+		},
+		"any origin with credentials": {
+			cors:     changeresponse.CORS{AllowOrigins: []string{"https://example.com", "*"}, AllowCredentials: true},
+			expected: "cors: allowCredentials can not be used with any origin *, list allowed origins instead",
+		},
+	}
+
+	for name, d := range datasets {
+		config := &changeresponse.Config{
+			Overrides: []changeresponse.Override{{From: []int{500}, To: 200}},
+			CORS:      &d.cors,
+		}
+
+		if _, err := changeresponse.New(context.Background(), next, config, "test-plugin"); err == nil || err.Error() != d.expected {
+			t.Errorf("%s: unexpected error\nactual:   %v\nexpected: %s", name, err, d.expected)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package traefik_change_response
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultDebugHeader = "X-Change-Response-Debug"
+	debugTrailer       = "X-Change-Response-Summary"
+)
+
+// debugInfo describes changes made to the response by override rules
+type debugInfo struct {
+	Plugin         string      `json:"plugin"`
+	Rules          []debugRule `json:"rules"`
+	OriginalStatus int         `json:"originalStatus"`
+	Status         int         `json:"status"`
+	OriginalLength int         `json:"originalLength"`
+	Length         int         `json:"length"`
+	HeadersAdded   []string    `json:"headersAdded,omitempty"`
+	HeadersRemoved []string    `json:"headersRemoved,omitempty"`
+}
+
+// debugRule is an applied override rule
+type debugRule struct {
+	Index int    `json:"index"`
+	Name  string `json:"name,omitempty"`
+	To    int    `json:"to"`
+}
+
+// debugEnabled checks if debug headers should be added to the response for the request. Debug header is removed from
+// the request, so that the secret is not forwarded to the backend
+func (a *Plugin) debugEnabled(req *http.Request) bool {
+	if a.config.DebugSecret == "" {
+		return a.config.Debug
+	}
+
+	header := a.config.DebugHeader
+	if header == "" {
+		header = defaultDebugHeader
+	}
+
+	value := req.Header.Get(header)
+	req.Header.Del(header)
+
+	return a.config.Debug && subtle.ConstantTimeCompare([]byte(value), []byte(a.config.DebugSecret)) == 1
+}
+
+// writeHeaders adds debug headers to the response
+func (d *debugInfo) writeHeaders(headers http.Header) {
+	for _, r := range d.Rules {
+		headers.Add("X-Change-Response-Rule", r.label())
+	}
+
+	headers.Set("X-Change-Response-Original-Status", strconv.Itoa(d.OriginalStatus))
+	headers.Set("X-Change-Response-Original-Length", strconv.Itoa(d.OriginalLength))
+
+	if len(d.HeadersAdded) > 0 {
+		headers.Set("X-Change-Response-Headers-Added", strings.Join(d.HeadersAdded, ", "))
+	}
+
+	if len(d.HeadersRemoved) > 0 {
+		headers.Set("X-Change-Response-Headers-Removed", strings.Join(d.HeadersRemoved, ", "))
+	}
+}
+
+// trailer returns debug info encoded for the response trailer
+func (d *debugInfo) trailer() string {
+	encoded, _ := json.Marshal(d)
+
+	return string(encoded)
+}
+
+// label returns rule name or its index if name is not defined
+func (r debugRule) label() string {
+	return ruleLabel(r.Index, r.Name)
+}
+
+// ruleLabel returns rule name or its index if name is not defined
+func ruleLabel(index int, name string) string {
+	if name != "" {
+		return name
+	}
+
+	return "#" + strconv.Itoa(index)
+}
+
+// acceptsTrailers checks if client supports response trailers
+func acceptsTrailers(req *http.Request) bool {
+	for _, te := range req.Header.Values("TE") {
+		for _, v := range strings.Split(te, ",") {
+			if strings.EqualFold(strings.TrimSpace(v), "trailers") {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// diffHeaders lists sorted names of headers added or changed and removed in the modified headers
+func diffHeaders(original http.Header, modified http.Header) (changed []string, removed []string) {
+	for k, hv := range modified {
+		if !slices.Equal(original[k], hv) {
+			changed = append(changed, k)
+		}
+	}
+
+	for k := range original {
+		if _, ok := modified[k]; !ok {
+			removed = append(removed, k)
+		}
+	}
+
+	slices.Sort(changed)
+	slices.Sort(removed)
+
+	return changed, removed
+}
@@ -0,0 +1,101 @@
+package traefik_change_response_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	changeresponse "github.com/bravepickle/traefik-change-response"
+)
+
+func TestDebugHeaders(t *testing.T) {
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if v := req.Header.Get("X-Change-Response-Debug"); v != "" {
+			t.Errorf("Debug header must not reach the backend: %s", v)
+		}
+
+		rw.Header().Set("Server", "dummy server")
+		rw.Header().Set("X-Foo", "initial")
+		rw.WriteHeader(http.StatusServiceUnavailable)
+		_, _ = rw.Write([]byte("Some error"))
+	})
+
+	config := &changeresponse.Config{
+		Overrides: []changeresponse.Override{
+			{
+				Name:          "hide errors",
+				From:          []int{503},
+				To:            200,
+				Headers:       http.Header{"X-Foo": []string{"bar"}},
+				RemoveHeaders: []string{"Server"},
+				Body:          "Everything is fine",
+			},
+			{From: []int{503}, To: 202, Mode: changeresponse.ModeKeep},
+		},
+		Debug:       true,
+		DebugSecret: "s3cret",
+	}
+
+	handler, err := changeresponse.New(context.Background(), next, config, "test-plugin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Test 1. Debug headers are hidden without the secret
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "http://localhost", nil))
+
+	for _, h := range []string{"X-Applied-Plugin", "X-Change-Response-Rule", "X-Change-Response-Original-Status"} {
+		if v := recorder.Header().Get(h); v != "" {
+			t.Errorf("Unexpected debug header %s: %s", h, v)
+		}
+	}
+
+	// Test 2. Debug headers and trailer with the secret
+	req := httptest.NewRequest(http.MethodGet, "http://localhost", nil)
+	req.Header.Set("X-Change-Response-Debug", "s3cret")
+	req.Header.Set("TE", "trailers")
+
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, req)
+
+	expected := http.Header{
+		"X-Applied-Plugin":                  []string{"test-plugin"},
+		"X-Change-Response-Rule":            []string{"hide errors", "#1"},
+		"X-Change-Response-Original-Status": []string{"503"},
+		"X-Change-Response-Original-Length": []string{"10"},
+		"X-Change-Response-Headers-Added":   []string{"Cache-Control, X-Foo"},
+		"X-Change-Response-Headers-Removed": []string{"Server"},
+	}
+
+	for k := range expected {
+		assertHeadersEqual(t, k, recorder.Header(), expected)
+	}
+
+	if recorder.Code != 202 {
+		t.Errorf("Status code mismatch: got %d, want %d", recorder.Code, 202)
+	}
+
+	var summary struct {
+		Plugin         string `json:"plugin"`
+		OriginalStatus int    `json:"originalStatus"`
+		Status         int    `json:"status"`
+		Length         int    `json:"length"`
+		Rules          []struct {
+			Index int    `json:"index"`
+			Name  string `json:"name"`
+		} `json:"rules"`
+	}
+
+	trailer := recorder.Result().Trailer.Get("X-Change-Response-Summary")
+	if err := json.Unmarshal([]byte(trailer), &summary); err != nil {
+		t.Fatalf("Invalid debug trailer %q: %s", trailer, err)
+	}
+
+	if summary.Plugin != "test-plugin" || summary.OriginalStatus != 503 || summary.Status != 202 ||
+		summary.Length != len("Everything is fine") || len(summary.Rules) != 2 || summary.Rules[0].Name != "hide errors" {
+		t.Errorf("Debug trailer mismatch: %s", trailer)
+	}
+}
@@ -0,0 +1,177 @@
+package traefik_change_response
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// unmarshalOverride decodes override rule of the rules file rejecting unknown fields. The document is normalized to
+// the rule type before decoding, so that values are accepted in the same shape as Traefik accepts them in plugin
+// configuration
+func unmarshalOverride(data []byte, o *Override) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber() // keep large integers intact
+
+	var raw any
+	if err := decoder.Decode(&raw); err != nil {
+		return err
+	}
+
+	encoded, err := json.Marshal(normalizeValue(raw, reflect.TypeOf(o)))
+	if err != nil {
+		return err
+	}
+
+	strictDecoder := json.NewDecoder(bytes.NewReader(encoded))
+	strictDecoder.DisallowUnknownFields()
+
+	return strictDecoder.Decode(o)
+}
+
+// normalizeValue converts decoded JSON value to the shape expected by the type as Traefik weakly typed decoding does:
+//   - numbers and booleans written as strings, e.g. "200" or "true"
+//   - numbers and booleans where strings are expected
+//   - single values where lists are expected, e.g. header value "X-Foo": "bar"
+//   - numeric lists and name lists tagged with list:"comma" written as comma-separated strings, e.g. "500,502".
+//     Free-form values, such as cookies or header values, are never split
+//
+// Values that can not be converted are left as is for JSON decoder to report them
+func normalizeValue(value any, t reflect.Type) any {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	if value == nil {
+		return nil
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		return normalizeStruct(value, t)
+	case reflect.Slice, reflect.Array:
+		return normalizeList(value, t, false)
+	case reflect.Map:
+		return normalizeMap(value, t)
+	case reflect.String:
+		switch v := value.(type) {
+		case json.Number, bool:
+			return fmt.Sprint(v)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if s, ok := value.(string); ok {
+			if n, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64); err == nil {
+				return n
+			}
+		}
+	case reflect.Float32, reflect.Float64:
+		if s, ok := value.(string); ok {
+			if f, err := strconv.ParseFloat(strings.TrimSpace(s), 64); err == nil {
+				return f
+			}
+		}
+	case reflect.Bool:
+		if s, ok := value.(string); ok {
+			if b, err := strconv.ParseBool(strings.TrimSpace(s)); err == nil {
+				return b
+			}
+		}
+	}
+
+	return value
+}
+
+// normalizeStruct normalizes object fields. Keys are matched to fields ignoring case as JSON decoder does
+func normalizeStruct(value any, t reflect.Type) any {
+	fields, ok := value.(map[string]any)
+	if !ok {
+		return value
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+
+		if name == "" {
+			name = field.Name
+		}
+
+		for key, v := range fields {
+			if !strings.EqualFold(key, name) {
+				continue
+			}
+
+			if field.Tag.Get("list") == "comma" {
+				fields[key] = normalizeList(v, field.Type, true)
+			} else {
+				fields[key] = normalizeValue(v, field.Type)
+			}
+		}
+	}
+
+	return fields
+}
+
+// normalizeList normalizes list items. Strings are split by commas for numeric lists and name lists only
+func normalizeList(value any, t reflect.Type, names bool) any {
+	items, ok := value.([]any)
+	if !ok {
+		s, isString := value.(string)
+
+		switch {
+		case isString && t.Elem().Kind() == reflect.Uint8:
+			return value // []byte is a base64 string
+		case isString && (names || isNumeric(t.Elem())):
+			items = []any{}
+
+			for _, item := range strings.Split(s, ",") {
+				if item = strings.TrimSpace(item); item != "" {
+					items = append(items, item)
+				}
+			}
+		default:
+			items = []any{value}
+		}
+	}
+
+	for i, item := range items {
+		items[i] = normalizeValue(item, t.Elem())
+	}
+
+	return items
+}
+
+// isNumeric reports whether the type is a number
+func isNumeric(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Float32, reflect.Float64:
+		return true
+	default:
+		return false
+	}
+}
+
+// normalizeMap normalizes map values
+func normalizeMap(value any, t reflect.Type) any {
+	entries, ok := value.(map[string]any)
+	if !ok {
+		return value
+	}
+
+	for k, v := range entries {
+		entries[k] = normalizeValue(v, t.Elem())
+	}
+
+	return entries
+}
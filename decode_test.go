@@ -0,0 +1,99 @@
+package traefik_change_response_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	changeresponse "github.com/bravepickle/traefik-change-response"
+)
+
+func TestRulesFileDecoding(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.json")
+	writeRulesFile(t, path, `{"overrides": [{
+		"from": "500, 502",
+		"to": "200",
+		"headers": {"X-Foo": "a, b", "X-Version": 2},
+		"removeHeaders": "Server, X-Powered-By",
+		"cookies": {"add": "a=b; Expires=Wed, 21 Oct 2030 07:28:00 GMT"},
+		"dryRun": "false",
+		"body": 404
+	}]}`)
+
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.Header().Set("Server", "backend")
+		rw.Header().Set("X-Powered-By", "backend")
+		rw.WriteHeader(http.StatusBadGateway)
+	})
+
+	handler, err := changeresponse.New(context.Background(), next, &changeresponse.Config{RulesFile: path}, "test-plugin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "http://localhost", nil))
+
+	if recorder.Code != http.StatusOK || recorder.Body.String() != "404" {
+		t.Errorf("Unexpected response: [%d] %s", recorder.Code, recorder.Body.String())
+	}
+
+	expected := http.Header{
+		"X-Foo":        []string{"a, b"}, // header values are not split
+		"X-Version":    []string{"2"},
+		"Set-Cookie":   []string{"a=b; Expires=Wed, 21 Oct 2030 07:28:00 GMT"},
+		"Server":       nil,
+		"X-Powered-By": nil,
+	}
+
+	for name := range expected {
+		assertHeadersEqual(t, name, recorder.Header(), expected)
+	}
+}
+
+func TestRulesFileDecodingErrors(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.json")
+
+	datasets := []struct {
+		name     string
+		contents string
+		expected string
+	}{
+		{
+			name:     "invalid number",
+			contents: `{"overrides": [{"from": "500,5xx", "to": "200"}]}`,
+			expected: "json: cannot unmarshal string into",
+		},
+		{
+			name:     "header lines",
+			contents: `{"overrides": [{"from": "500", "to": "200", "headers": "X-Foo: bar"}]}`,
+			expected: "json: cannot unmarshal string into",
+		},
+		{
+			name:     "security headers preset name",
+			contents: `{"overrides": [{"from": "500", "to": "200", "securityHeaders": "strict"}]}`,
+			expected: "json: cannot unmarshal string into",
+		},
+		{
+			name:     "unknown security headers field",
+			contents: `{"overrides": [{"from": "500", "to": "200", "securityHeaders": {"preset": "strict", "only": true}}]}`,
+			expected: `json: unknown field "only"`,
+		},
+	}
+
+	for _, d := range datasets {
+		t.Run(d.name, func(t *testing.T) {
+			writeRulesFile(t, path, d.contents)
+
+			_, err := changeresponse.New(context.Background(), http.NotFoundHandler(), &changeresponse.Config{RulesFile: path}, "test-plugin")
+
+			prefix := "cannot parse rules file " + path + ": override 0: "
+			if err == nil || !strings.HasPrefix(err.Error(), prefix+d.expected) {
+				t.Errorf("Unexpected error\nactual:   %v\nexpected: %s", err, prefix+d.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,255 @@
+package traefik_change_response
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Invalid JSON policies
+const (
+	InvalidKeep   = "keep"
+	InvalidString = "string"
+	InvalidNull   = "null"
+)
+
+// Envelope wraps JSON body into an envelope object in envelope mode or extracts its sub-document in unwrap mode
+type Envelope struct {
+	// Key of the field to put the body under in envelope mode. Optional, default data
+	Key string `json:"key,omitempty"`
+
+	// Fields of the envelope with constant JSON values in envelope mode, e.g. error: "null". Optional
+	Fields map[string]string `json:"fields,omitempty"`
+
+	// MetaKey of the meta object field in envelope mode. Optional, default meta
+	MetaKey string `json:"metaKey,omitempty"`
+
+	// Meta fields of the meta object in envelope mode. Values are strings supporting {{name}} placeholders, values
+	// consisting of {{status}} placeholder only are numbers. Optional
+	Meta map[string]string `json:"meta,omitempty"`
+
+	// Path of the sub-document to extract in unwrap mode, dot separated field names and array indexes, e.g.
+	// data.items.0. Required in unwrap mode
+	Path string `json:"path,omitempty"`
+
+	// OnInvalid policy for bodies that are not valid JSON or miss the unwrap path. Optional
+	// Allowed:
+	//   keep (default) - keep the body as it is
+	//   string - use the body as JSON string
+	//   null - use null
+	OnInvalid string `json:"onInvalid,omitempty"`
+}
+
+// envelopeRules is an envelope prepared for processing responses
+type envelopeRules struct {
+	config *Envelope
+	fields []envelopeField // constant fields in order of keys
+	meta   []envelopeField // meta fields in order of keys
+	path   []string
+}
+
+// envelopeField is an envelope field with its value
+type envelopeField struct {
+	key      string
+	value    string // JSON value of constant fields, template of meta fields
+	template bool   // value contains template placeholders
+	number   bool   // value is a number
+}
+
+// compileEnvelope validates envelope for the mode and sets defaults
+func compileEnvelope(config *Envelope, mode string) (*envelopeRules, error) {
+	if config.Key == "" {
+		config.Key = "data"
+	}
+
+	if config.MetaKey == "" {
+		config.MetaKey = "meta"
+	}
+
+	switch config.OnInvalid {
+	case "":
+		config.OnInvalid = InvalidKeep
+	case InvalidKeep, InvalidString, InvalidNull:
+	default:
+		return nil, fmt.Errorf("unsupported onInvalid policy: %s", config.OnInvalid)
+	}
+
+	e := &envelopeRules{config: config}
+
+	if mode == ModeUnwrap {
+		if config.Path == "" {
+			return nil, fmt.Errorf("path is required in unwrap mode")
+		}
+
+		e.path = strings.Split(config.Path, ".")
+
+		return e, nil
+	}
+
+	if len(config.Meta) > 0 && config.MetaKey == config.Key {
+		return nil, fmt.Errorf("metaKey must differ from key: %s", config.Key)
+	}
+
+	for key, value := range config.Fields {
+		if key == config.Key || (key == config.MetaKey && len(config.Meta) > 0) {
+			return nil, fmt.Errorf("field %s: collides with body or meta key", key)
+		}
+
+		if !json.Valid([]byte(value)) {
+			return nil, fmt.Errorf("field %s: invalid JSON value: %s", key, value)
+		}
+
+		e.fields = append(e.fields, envelopeField{key: key, value: value})
+	}
+
+	for key, value := range config.Meta {
+		e.meta = append(e.meta, envelopeField{
+			key:      key,
+			value:    value,
+			template: strings.Contains(value, "{{"),
+			number:   strings.TrimSpace(value) == "{{status}}",
+		})
+	}
+
+	sort.Slice(e.fields, func(i, j int) bool { return e.fields[i].key < e.fields[j].key })
+	sort.Slice(e.meta, func(i, j int) bool { return e.meta[i].key < e.meta[j].key })
+
+	return e, nil
+}
+
+// wrapBody puts JSON body into the envelope. Returns false if the body was kept as it is
+func (s *responseState) wrapBody(e *envelopeRules, vars *templateVars) bool {
+	if s.spill != nil {
+		return false // spilled bodies are not parsed
+	}
+
+	var data bytes.Buffer
+	if err := json.Compact(&data, s.body.Bytes()); err != nil && !e.invalidValue(&data, s.body.Bytes()) {
+		return false
+	}
+
+	var b bytes.Buffer
+	b.WriteByte('{')
+	writeJSON(&b, e.config.Key)
+	b.WriteByte(':')
+	b.Write(data.Bytes())
+
+	for _, field := range e.fields {
+		b.WriteByte(',')
+		writeJSON(&b, field.key)
+		b.WriteByte(':')
+		b.WriteString(field.value)
+	}
+
+	if len(e.meta) > 0 {
+		b.WriteByte(',')
+		writeJSON(&b, e.config.MetaKey)
+		b.WriteString(":{")
+
+		for i, field := range e.meta {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+
+			value := field.value
+			if field.template {
+				value = renderTemplate(value, vars, nil)
+			}
+
+			writeJSON(&b, field.key)
+			b.WriteByte(':')
+
+			if field.number {
+				b.WriteString(value)
+			} else {
+				writeJSON(&b, value)
+			}
+		}
+
+		b.WriteByte('}')
+	}
+
+	b.WriteByte('}')
+
+	s.replaceJSON(b.Bytes())
+
+	return true
+}
+
+// unwrapBody replaces JSON body with its sub-document. Returns false if the body was kept as it is
+func (s *responseState) unwrapBody(e *envelopeRules) bool {
+	if s.spill != nil {
+		return false // spilled bodies are not parsed
+	}
+
+	var data bytes.Buffer
+	if document, ok := extractJSON(s.body.Bytes(), e.path); ok {
+		_ = json.Compact(&data, document)
+	} else if !e.invalidValue(&data, s.body.Bytes()) {
+		return false
+	}
+
+	s.replaceJSON(data.Bytes())
+
+	return true
+}
+
+// invalidValue writes JSON value replacing invalid body according to the policy. Returns false if the body must be
+// kept as it is
+func (e *envelopeRules) invalidValue(b *bytes.Buffer, body []byte) bool {
+	b.Reset()
+
+	switch e.config.OnInvalid {
+	case InvalidString:
+		writeJSON(b, string(body))
+	case InvalidNull:
+		b.WriteString("null")
+	default:
+		return false
+	}
+
+	return true
+}
+
+// replaceJSON replaces body with JSON document
+func (s *responseState) replaceJSON(body []byte) {
+	s.body.Reset()
+	s.body.Write(body)
+	s.headers.Set("Content-Type", "application/json")
+}
+
+// extractJSON returns JSON sub-document at the path of field names and array indexes
+func extractJSON(document []byte, path []string) (json.RawMessage, bool) {
+	current := json.RawMessage(document)
+
+	for _, step := range path {
+		var object map[string]json.RawMessage
+		if err := json.Unmarshal(current, &object); err == nil {
+			value, ok := object[step]
+			if !ok {
+				return nil, false
+			}
+
+			current = value
+
+			continue
+		}
+
+		var array []json.RawMessage
+		if err := json.Unmarshal(current, &array); err != nil {
+			return nil, false
+		}
+
+		index, err := strconv.Atoi(step)
+		if err != nil || index < 0 || index >= len(array) {
+			return nil, false
+		}
+
+		current = array[index]
+	}
+
+	return current, true // sub-documents are valid once the document is decoded
+}
@@ -0,0 +1,250 @@
+package traefik_change_response_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	changeresponse "github.com/bravepickle/traefik-change-response"
+)
+
+func TestEnvelope(t *testing.T) {
+	jsonHeaders := http.Header{"Content-Type": []string{"application/json"}}
+
+	datasets := []struct {
+		name         string
+		mode         string
+		envelope     *changeresponse.Envelope
+		headers      http.Header
+		body         string
+		expectedType string
+		expectedBody string
+	}{
+		{
+			name:         "default envelope",
+			mode:         changeresponse.ModeEnvelope,
+			headers:      jsonHeaders,
+			body:         "{\n  \"id\": 42,\n  \"name\": \"Tom\"\n}",
+			expectedType: "application/json",
+			expectedBody: `{"data":{"id":42,"name":"Tom"}}`,
+		},
+		{
+			name: "fields and meta",
+			mode: changeresponse.ModeEnvelope,
+			envelope: &changeresponse.Envelope{
+				Key:     "payload",
+				Fields:  map[string]string{"error": "null", "version": `"v2"`},
+				MetaKey: "info",
+				Meta:    map[string]string{"status": "{{status}}", "method": "{{method}}", "path": `"{{path}}"`},
+			},
+			headers:      jsonHeaders,
+			body:         `[1,2]`,
+			expectedType: "application/json",
+			expectedBody: `{"payload":[1,2],"error":null,"version":"v2","info":{"method":"GET","path":"\"/orders\"","status":500}}`,
+		},
+		{
+			name:         "invalid json is kept",
+			mode:         changeresponse.ModeEnvelope,
+			headers:      http.Header{"Content-Type": []string{"text/plain"}},
+			body:         "Some error",
+			expectedType: "text/plain",
+			expectedBody: "Some error",
+		},
+		{
+			name:         "invalid json as string",
+			mode:         changeresponse.ModeEnvelope,
+			envelope:     &changeresponse.Envelope{OnInvalid: changeresponse.InvalidString, Fields: map[string]string{"error": "true"}},
+			headers:      http.Header{"Content-Type": []string{"text/plain"}},
+			body:         "Some <error>",
+			expectedType: "application/json",
+			expectedBody: `{"data":"Some <error>","error":true}`,
+		},
+		{
+			name:         "invalid json as null",
+			mode:         changeresponse.ModeEnvelope,
+			envelope:     &changeresponse.Envelope{OnInvalid: changeresponse.InvalidNull},
+			body:         "",
+			expectedType: "application/json",
+			expectedBody: `{"data":null}`,
+		},
+		{
+			name:         "unwrap",
+			mode:         changeresponse.ModeUnwrap,
+			envelope:     &changeresponse.Envelope{Path: "data.items.1"},
+			headers:      jsonHeaders,
+			body:         `{"data": {"items": [{"id": 1}, {"z": 2, "a": [true, null]}]}, "error": null}`,
+			expectedType: "application/json",
+			expectedBody: `{"z":2,"a":[true,null]}`,
+		},
+		{
+			name:         "unwrap missing path",
+			mode:         changeresponse.ModeUnwrap,
+			envelope:     &changeresponse.Envelope{Path: "data.items.5"},
+			headers:      jsonHeaders,
+			body:         `{"data":{"items":[]}}`,
+			expectedType: "application/json",
+			expectedBody: `{"data":{"items":[]}}`,
+		},
+		{
+			name:         "unwrap missing path as null",
+			mode:         changeresponse.ModeUnwrap,
+			envelope:     &changeresponse.Envelope{Path: "data.id", OnInvalid: changeresponse.InvalidNull},
+			headers:      jsonHeaders,
+			body:         `{"error":"not found"}`,
+			expectedType: "application/json",
+			expectedBody: `null`,
+		},
+	}
+
+	for _, d := range datasets {
+		t.Run(d.name, func(t *testing.T) {
+			handler := newPluginHandler(t, inputDataset{
+				config: changeresponse.Config{
+					Overrides: []changeresponse.Override{{
+						From:     []int{500},
+						To:       502,
+						Mode:     d.mode,
+						Envelope: d.envelope,
+					}},
+				},
+				responseCode:    http.StatusInternalServerError,
+				responseHeaders: d.headers,
+				responseBody:    d.body,
+			})
+
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "http://localhost/orders", nil))
+
+			if actual := recorder.Header().Get("Content-Type"); actual != d.expectedType {
+				t.Errorf("Content-Type mismatch: got %q, want %q", actual, d.expectedType)
+			}
+
+			if actual := recorder.Body.String(); actual != d.expectedBody {
+				t.Errorf("Body mismatch\nactual:   %s\nexpected: %s", actual, d.expectedBody)
+			}
+		})
+	}
+}
+
+func TestEnvelopeTimestamp(t *testing.T) {
+	recorder := servePlugin(t, inputDataset{
+		config: changeresponse.Config{
+			Overrides: []changeresponse.Override{{
+				From:     []int{200},
+				To:       200,
+				Mode:     changeresponse.ModeEnvelope,
+				Envelope: &changeresponse.Envelope{Meta: map[string]string{"timestamp": "{{timestamp}}"}},
+			}},
+		},
+		responseCode: http.StatusOK,
+		responseBody: `{"id":42}`,
+	})
+
+	var envelope struct {
+		Meta struct {
+			Timestamp string `json:"timestamp"`
+		} `json:"meta"`
+	}
+
+	if err := json.Unmarshal(recorder.Body.Bytes(), &envelope); err != nil {
+		t.Fatalf("Invalid envelope %s: %s", recorder.Body.String(), err)
+	}
+
+	timestamp, err := time.Parse(time.RFC3339, envelope.Meta.Timestamp)
+	if err != nil || time.Since(timestamp) > time.Minute {
+		t.Errorf("Unexpected timestamp %q: %v", envelope.Meta.Timestamp, err)
+	}
+}
+
+func TestEnvelopeConfig(t *testing.T) {
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {})
+
+	datasets := []struct {
+		name     string
+		override changeresponse.Override
+		expected string
+	}{
+		{
+			name:     "unwrap without path",
+			override: changeresponse.Override{From: []int{500}, To: 200, Mode: changeresponse.ModeUnwrap},
+			expected: "override 0: envelope: path is required in unwrap mode",
+		},
+		{
+			name: "invalid field value",
+			override: changeresponse.Override{
+				From:     []int{500},
+				To:       200,
+				Mode:     changeresponse.ModeEnvelope,
+				Envelope: &changeresponse.Envelope{Fields: map[string]string{"error": "none"}},
+			},
+			expected: "override 0: envelope: field error: invalid JSON value: none",
+		},
+		{
+			name: "field colliding with key",
+			override: changeresponse.Override{
+				From:     []int{500},
+				To:       200,
+				Mode:     changeresponse.ModeEnvelope,
+				Envelope: &changeresponse.Envelope{Fields: map[string]string{"data": "null"}},
+			},
+			expected: "override 0: envelope: field data: collides with body or meta key",
+		},
+		{
+			name: "field colliding with meta key",
+			override: changeresponse.Override{
+				From: []int{500},
+				To:   200,
+				Mode: changeresponse.ModeEnvelope,
+				Envelope: &changeresponse.Envelope{
+					Fields:  map[string]string{"info": "{}"},
+					MetaKey: "info",
+					Meta:    map[string]string{"status": "{{status}}"},
+				},
+			},
+			expected: "override 0: envelope: field info: collides with body or meta key",
+		},
+		{
+			name: "meta key equal to key",
+			override: changeresponse.Override{
+				From:     []int{500},
+				To:       200,
+				Mode:     changeresponse.ModeEnvelope,
+				Envelope: &changeresponse.Envelope{Key: "payload", MetaKey: "payload", Meta: map[string]string{"id": "1"}},
+			},
+			expected: "override 0: envelope: metaKey must differ from key: payload",
+		},
+		{
+			name: "unsupported policy",
+			override: changeresponse.Override{
+				From:     []int{500},
+				To:       200,
+				Mode:     changeresponse.ModeEnvelope,
+				Envelope: &changeresponse.Envelope{OnInvalid: "fail"},
+			},
+			expected: "override 0: envelope: unsupported onInvalid policy: fail",
+		},
+		{
+			name: "envelope without mode",
+			override: changeresponse.Override{
+				From:     []int{500},
+				To:       200,
+				Envelope: &changeresponse.Envelope{},
+			},
+			expected: "override 0: envelope is supported only in envelope and unwrap modes",
+		},
+	}
+
+	for _, d := range datasets {
+		t.Run(d.name, func(t *testing.T) {
+			config := &changeresponse.Config{Overrides: []changeresponse.Override{d.override}}
+
+			_, err := changeresponse.New(context.Background(), next, config, "test-plugin")
+			if err == nil || err.Error() != d.expected {
+				t.Errorf("Unexpected error\nactual:   %v\nexpected: %s", err, d.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,195 @@
+package traefik_change_response
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Fault injects failures into matching requests for chaos testing. Override rules are applied on top of injected faults
+type Fault struct {
+	// Percentage of matching requests to inject faults into, 0 < percentage <= 100. Required
+	Percentage float64 `json:"percentage"`
+
+	// Methods list of request methods to match. Optional, all methods match by default
+	Methods []string `json:"methods,omitempty" list:"comma"`
+
+	// PathPrefix request URL path prefix to match. Optional
+	PathPrefix string `json:"pathPrefix,omitempty"`
+
+	// Headers request header values to match. Optional
+	Headers map[string]string `json:"headers,omitempty"`
+
+	// Header name of request header activating fault injection. Optional, faults are always active if not defined
+	Header string `json:"header,omitempty"`
+
+	// Secret expected value of the activation header. Required if header is defined
+	Secret string `json:"secret,omitempty"`
+
+	// Abort skips calling the backend and responds as defined. Optional
+	Abort *FaultAbort `json:"abort,omitempty"`
+
+	// Delay latency to add before calling the backend, e.g. 500ms. Optional
+	Delay string `json:"delay,omitempty"`
+
+	// Truncate max number of bytes to keep from the backend response body. Optional, 0 - disabled
+	Truncate int `json:"truncate,omitempty"`
+}
+
+// FaultAbort is a response returned instead of calling the backend
+type FaultAbort struct {
+	// Status HTTP status code to respond with. Required
+	Status int `json:"status"`
+
+	// Headers sets defined headers in response. Optional
+	Headers http.Header `json:"headers,omitempty"`
+
+	// Body response body contents. Optional
+	Body string `json:"body,omitempty"`
+}
+
+// faultInjector decides which requests get injected faults
+type faultInjector struct {
+	config *Fault
+	delay  time.Duration
+}
+
+// newFaultInjector validates fault injection configuration
+func newFaultInjector(config *Fault) (*faultInjector, error) {
+	if config.Percentage <= 0 || config.Percentage > 100 {
+		return nil, fmt.Errorf("fault percentage must be within (0, 100]: %v", config.Percentage)
+	}
+
+	if config.Header != "" && config.Secret == "" {
+		return nil, fmt.Errorf("fault secret is required for activation header %s", config.Header)
+	}
+
+	if config.Abort != nil && (config.Abort.Status < 100 || config.Abort.Status > 999) {
+		return nil, fmt.Errorf("invalid fault abort status code: %d", config.Abort.Status)
+	}
+
+	if config.Truncate < 0 {
+		return nil, fmt.Errorf("fault truncate must not be negative: %d", config.Truncate)
+	}
+
+	injector := &faultInjector{config: config}
+
+	if config.Delay != "" {
+		var err error
+		if injector.delay, err = time.ParseDuration(config.Delay); err != nil {
+			return nil, fmt.Errorf("invalid fault delay: %w", err)
+		}
+	}
+
+	if config.Abort == nil && injector.delay == 0 && config.Truncate == 0 {
+		return nil, fmt.Errorf("at least one fault action is required: abort, delay or truncate")
+	}
+
+	return injector, nil
+}
+
+// match checks if fault should be injected into the request. Activation header is removed from the request, so that
+// the secret is not forwarded to the backend
+func (f *faultInjector) match(req *http.Request) bool {
+	if f.config.Header != "" {
+		value := req.Header.Get(f.config.Header)
+		req.Header.Del(f.config.Header)
+
+		if subtle.ConstantTimeCompare([]byte(value), []byte(f.config.Secret)) != 1 {
+			return false
+		}
+	}
+
+	if len(f.config.Methods) > 0 && !containsFold(f.config.Methods, req.Method) {
+		return false
+	}
+
+	if !strings.HasPrefix(req.URL.Path, f.config.PathPrefix) {
+		return false
+	}
+
+	for k, v := range f.config.Headers {
+		if req.Header.Get(k) != v {
+			return false
+		}
+	}
+
+	return f.config.Percentage >= 100 || rand.Float64()*100 < f.config.Percentage
+}
+
+// wait adds configured latency. Returns false if request was canceled while waiting
+func (f *faultInjector) wait(req *http.Request) bool {
+	if f.delay == 0 {
+		return true
+	}
+
+	timer := time.NewTimer(f.delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-req.Context().Done():
+		return false
+	}
+}
+
+// abort writes the configured response instead of the backend one
+func (f *faultInjector) abort(wrapper *ResponseWriterWrapper) {
+	headers := wrapper.Header()
+
+	for k, hv := range f.config.Abort.Headers {
+		headers.Del(k)
+
+		for _, h := range hv {
+			headers.Add(k, h)
+		}
+	}
+
+	wrapper.WriteHeader(f.config.Abort.Status)
+	wrapper.body.WriteString(f.config.Abort.Body)
+}
+
+// truncate cuts backend response body to the configured size
+func (f *faultInjector) truncate(wrapper *ResponseWriterWrapper) {
+	if f.config.Truncate <= 0 || wrapper.bodySize() <= int64(f.config.Truncate) {
+		return
+	}
+
+	if wrapper.spill != nil {
+		wrapper.spill.size = int64(f.config.Truncate)
+	} else {
+		wrapper.body.Truncate(f.config.Truncate)
+	}
+}
+
+// actions lists injected fault actions for debugging
+func (f *faultInjector) actions() string {
+	var actions []string
+
+	if f.delay > 0 {
+		actions = append(actions, "delay")
+	}
+
+	if f.config.Abort != nil {
+		actions = append(actions, "abort")
+	} else if f.config.Truncate > 0 {
+		actions = append(actions, "truncate")
+	}
+
+	return strings.Join(actions, ",")
+}
+
+// containsFold checks if list contains the value ignoring case
+func containsFold(list []string, value string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+
+	return false
+}
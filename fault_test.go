@@ -0,0 +1,175 @@
+package traefik_change_response_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	changeresponse "github.com/bravepickle/traefik-change-response"
+)
+
+func TestFault(t *testing.T) {
+	ctx := context.Background()
+
+	datasets := []struct {
+		name         string
+		fault        changeresponse.Fault
+		path         string
+		headers      http.Header
+		expectedCode int
+		expectedBody string
+		backendCalls int
+	}{
+		{
+			name: "abort with overrides on top",
+			fault: changeresponse.Fault{
+				Percentage: 100,
+				Abort:      &changeresponse.FaultAbort{Status: 503, Body: "injected"},
+			},
+			expectedCode: 500,
+			expectedBody: "error page",
+			backendCalls: 0,
+		},
+		{
+			name: "activation header",
+			fault: changeresponse.Fault{
+				Percentage: 100,
+				Header:     "X-Chaos",
+				Secret:     "s3cret",
+				Abort:      &changeresponse.FaultAbort{Status: 503},
+			},
+			headers:      http.Header{"X-Chaos": []string{"s3cret"}},
+			expectedCode: 500,
+			expectedBody: "error page",
+			backendCalls: 0,
+		},
+		{
+			name: "wrong secret",
+			fault: changeresponse.Fault{
+				Percentage: 100,
+				Header:     "X-Chaos",
+				Secret:     "s3cret",
+				Abort:      &changeresponse.FaultAbort{Status: 503},
+			},
+			headers:      http.Header{"X-Chaos": []string{"guess"}},
+			expectedCode: 200,
+			expectedBody: "backend response",
+			backendCalls: 1,
+		},
+		{
+			name: "path mismatch",
+			fault: changeresponse.Fault{
+				Percentage: 100,
+				PathPrefix: "/api",
+				Abort:      &changeresponse.FaultAbort{Status: 503},
+			},
+			path:         "/static/app.js",
+			expectedCode: 200,
+			expectedBody: "backend response",
+			backendCalls: 1,
+		},
+		{
+			name: "truncate",
+			fault: changeresponse.Fault{
+				Percentage: 100,
+				Methods:    []string{"get"},
+				Truncate:   7,
+			},
+			expectedCode: 200,
+			expectedBody: "backend",
+			backendCalls: 1,
+		},
+	}
+
+	for _, d := range datasets {
+		t.Run(d.name, func(t *testing.T) {
+			t.Parallel()
+
+			calls := 0
+			next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+				calls++
+				if v := req.Header.Get("X-Chaos"); v != "" {
+					t.Errorf("Fault activation header must not reach the backend: %s", v)
+				}
+
+				rw.WriteHeader(http.StatusOK)
+				_, _ = rw.Write([]byte("backend response"))
+			})
+
+			config := &changeresponse.Config{
+				Overrides: []changeresponse.Override{{From: []int{503}, To: 500, Body: "error page"}},
+				Fault:     &d.fault,
+			}
+
+			handler, err := changeresponse.New(ctx, next, config, "test-plugin")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "http://localhost"+d.path, nil)
+			for k, v := range d.headers {
+				req.Header[k] = v
+			}
+
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, req)
+
+			if recorder.Code != d.expectedCode {
+				t.Errorf("Status code mismatch: got %d, want %d", recorder.Code, d.expectedCode)
+			}
+
+			if recorder.Body.String() != d.expectedBody {
+				t.Errorf("Body mismatch\nactual:   %s\nexpected: %s", recorder.Body.String(), d.expectedBody)
+			}
+
+			if calls != d.backendCalls {
+				t.Errorf("Backend calls mismatch: got %d, want %d", calls, d.backendCalls)
+			}
+		})
+	}
+}
+
+func TestFaultDelay(t *testing.T) {
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {})
+	config := &changeresponse.Config{
+		Overrides: []changeresponse.Override{{From: []int{503}, To: 500}},
+		Fault:     &changeresponse.Fault{Percentage: 100, Delay: "30ms"},
+	}
+
+	handler, err := changeresponse.New(context.Background(), next, config, "test-plugin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "http://localhost", nil))
+
+	if elapsed := time.Since(start); elapsed < 30*time.Millisecond {
+		t.Errorf("Expected delay of at least 30ms, got %s", elapsed)
+	}
+}
+
+func TestFaultConfig(t *testing.T) {
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {})
+
+	datasets := map[string]changeresponse.Fault{
+		"missing percentage": {Delay: "1s"},
+		"missing action":     {Percentage: 10},
+		"missing secret":     {Percentage: 10, Delay: "1s", Header: "X-Chaos"},
+		"invalid delay":      {Percentage: 10, Delay: "long"},
+		"invalid status":     {Percentage: 10, Abort: &changeresponse.FaultAbort{}},
+	}
+
+	for name, fault := range datasets {
+		config := &changeresponse.Config{
+			Overrides: []changeresponse.Override{{From: []int{500}, To: 200}},
+			Fault:     &fault,
+		}
+
+		if _, err := changeresponse.New(context.Background(), next, config, "test-plugin"); err == nil {
+			t.Errorf("%s: expected configuration error", name)
+		}
+	}
+}
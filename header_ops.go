@@ -0,0 +1,158 @@
+package traefik_change_response
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// Header operations
+const (
+	HeaderOpSet     = "set"
+	HeaderOpAdd     = "add"
+	HeaderOpAppend  = "append"
+	HeaderOpReplace = "replace"
+	HeaderOpRename  = "rename"
+	HeaderOpRemove  = "remove"
+)
+
+// HeaderOp is a response header operation. Operations are applied in order after headers and removeHeaders of the rule
+type HeaderOp struct {
+	// Op operation to apply. Required
+	// Allowed:
+	//   set - replace header values with the value
+	//   add - add the value to header values
+	//   append - append the value to every header value, e.g. "; Secure" to Set-Cookie
+	//   replace - replace matches of the pattern in every header value with the value. Supports $1 group references
+	//   rename - move header values to header named "to", replacing its values
+	//   remove - remove headers with names matching the name glob pattern or nameRegex
+	Op string `json:"op"`
+
+	// Name of the header. Required, except for remove operation with nameRegex
+	Name string `json:"name,omitempty"`
+
+	// NameRegex regular expression matching names of headers to remove. Optional
+	NameRegex string `json:"nameRegex,omitempty"`
+
+	// Value to set, add, append or replace pattern matches with. Supports {{name}} placeholders. Optional
+	Value string `json:"value,omitempty"`
+
+	// Pattern regular expression to replace in header values. Required for replace operation
+	Pattern string `json:"pattern,omitempty"`
+
+	// To new header name for rename operation
+	To string `json:"to,omitempty"`
+}
+
+// headerOp is a header operation prepared for processing responses
+type headerOp struct {
+	op       string
+	name     string         // canonical header name
+	names    *regexp.Regexp // names of headers to remove
+	pattern  *regexp.Regexp // pattern to replace in values
+	value    string
+	template bool   // value contains template placeholders
+	to       string // canonical header name to rename to
+}
+
+// compileHeaderOp validates header operation and precompiles its patterns
+func compileHeaderOp(op *HeaderOp) (headerOp, error) {
+	c := headerOp{
+		op:       op.Op,
+		name:     http.CanonicalHeaderKey(op.Name),
+		value:    op.Value,
+		template: strings.Contains(op.Value, "{{"),
+		to:       http.CanonicalHeaderKey(op.To),
+	}
+
+	if op.Name == "" && (op.Op != HeaderOpRemove || op.NameRegex == "") {
+		return c, fmt.Errorf("header name is required for %s operation", op.Op)
+	}
+
+	var err error
+
+	switch op.Op {
+	case HeaderOpSet, HeaderOpAdd, HeaderOpAppend:
+	case HeaderOpReplace:
+		if op.Pattern == "" {
+			return c, fmt.Errorf("pattern is required for replace operation")
+		}
+
+		if c.pattern, err = regexp.Compile(op.Pattern); err != nil {
+			return c, fmt.Errorf("invalid pattern: %w", err)
+		}
+	case HeaderOpRename:
+		if op.To == "" {
+			return c, fmt.Errorf("new header name is required for rename operation")
+		}
+	case HeaderOpRemove:
+		if op.Name != "" && op.NameRegex != "" {
+			return c, fmt.Errorf("name and nameRegex are mutually exclusive")
+		}
+
+		pattern := op.NameRegex
+		if pattern == "" {
+			pattern = globPattern(op.Name)
+		}
+
+		if c.names, err = regexp.Compile("(?i)" + pattern); err != nil {
+			return c, fmt.Errorf("invalid name pattern: %w", err)
+		}
+	default:
+		return c, fmt.Errorf("unsupported header operation: %s", op.Op)
+	}
+
+	return c, nil
+}
+
+// globPattern converts glob pattern with * and ? wildcards to regular expression matching the whole string
+func globPattern(glob string) string {
+	pattern := regexp.QuoteMeta(glob)
+	pattern = strings.ReplaceAll(pattern, `\*`, ".*")
+	pattern = strings.ReplaceAll(pattern, `\?`, ".")
+
+	return "^" + pattern + "$"
+}
+
+// apply modifies headers according to the operation
+func (op *headerOp) apply(headers http.Header, vars *templateVars) {
+	value := op.value
+	if op.template {
+		value = renderTemplate(value, vars, nil)
+	}
+
+	switch op.op {
+	case HeaderOpSet:
+		headers[op.name] = []string{value}
+	case HeaderOpAdd:
+		headers[op.name] = append(headers[op.name], value)
+	case HeaderOpAppend, HeaderOpReplace:
+		values := headers[op.name]
+		if len(values) == 0 {
+			return
+		}
+
+		modified := make([]string, len(values)) // values may be shared with rules
+		for i, v := range values {
+			if op.op == HeaderOpAppend {
+				modified[i] = v + value
+			} else {
+				modified[i] = op.pattern.ReplaceAllString(v, value)
+			}
+		}
+
+		headers[op.name] = modified
+	case HeaderOpRename:
+		if values, ok := headers[op.name]; ok {
+			delete(headers, op.name)
+			headers[op.to] = values
+		}
+	case HeaderOpRemove:
+		for name := range headers {
+			if op.names.MatchString(name) {
+				delete(headers, name)
+			}
+		}
+	}
+}
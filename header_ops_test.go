@@ -0,0 +1,114 @@
+package traefik_change_response_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	changeresponse "github.com/bravepickle/traefik-change-response"
+)
+
+func TestHeaderOps(t *testing.T) {
+	d := inputDataset{
+		config: changeresponse.Config{
+			Overrides: []changeresponse.Override{{
+				From: []int{302},
+				To:   302,
+				Mode: changeresponse.ModeKeep,
+				HeaderOps: []changeresponse.HeaderOp{
+					{
+						Op:      changeresponse.HeaderOpReplace,
+						Name:    "location",
+						Pattern: `^http://internal-svc:8080/(.*)$`,
+						Value:   "https://{{host}}/$1",
+					},
+					{Op: changeresponse.HeaderOpAppend, Name: "Set-Cookie", Value: "; Secure; SameSite=Lax"},
+					{Op: changeresponse.HeaderOpRename, Name: "X-Upstream-Error", To: "X-Error"},
+					{Op: changeresponse.HeaderOpRemove, Name: "X-Internal-*"},
+					{Op: changeresponse.HeaderOpRemove, NameRegex: `^x-powered-by$`},
+					{Op: changeresponse.HeaderOpSet, Name: "X-Request-Method", Value: "{{method}}"},
+					{Op: changeresponse.HeaderOpAdd, Name: "Vary", Value: "Cookie"},
+					{Op: changeresponse.HeaderOpAppend, Name: "X-Missing", Value: "; ignored"},
+				},
+			}},
+		},
+		responseCode: http.StatusFound,
+		responseHeaders: http.Header{
+			"Location":          []string{"http://internal-svc:8080/login?next=%2F"},
+			"Set-Cookie":        []string{"session=1", "theme=dark"},
+			"X-Upstream-Error":  []string{"timeout"},
+			"X-Internal-Host":   []string{"10.0.0.1"},
+			"X-Internal-Region": []string{"eu"},
+			"X-Powered-By":      []string{"php"},
+			"Vary":              []string{"Accept-Encoding"},
+		},
+	}
+
+	recorder := servePlugin(t, d)
+
+	expected := http.Header{
+		"Location":         []string{"https://localhost/login?next=%2F"},
+		"Set-Cookie":       []string{"session=1; Secure; SameSite=Lax", "theme=dark; Secure; SameSite=Lax"},
+		"X-Error":          []string{"timeout"},
+		"X-Request-Method": []string{"GET"},
+		"Vary":             []string{"Accept-Encoding", "Cookie"},
+		"Content-Length":   []string{"0"},
+	}
+
+	if len(recorder.Header()) != len(expected) {
+		t.Errorf("Headers count mismatch: got %v, want %v", recorder.Header(), expected)
+	}
+
+	for name := range expected {
+		assertHeadersEqual(t, name, recorder.Header(), expected)
+	}
+}
+
+func TestHeaderOpsConfig(t *testing.T) {
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {})
+
+	datasets := []struct {
+		name     string
+		op       changeresponse.HeaderOp
+		expected string
+	}{
+		{
+			name:     "unsupported operation",
+			op:       changeresponse.HeaderOp{Op: "move", Name: "X-Foo"},
+			expected: "override 0: header operation 0: unsupported header operation: move",
+		},
+		{
+			name:     "missing name",
+			op:       changeresponse.HeaderOp{Op: changeresponse.HeaderOpSet, Value: "bar"},
+			expected: "override 0: header operation 0: header name is required for set operation",
+		},
+		{
+			name:     "invalid pattern",
+			op:       changeresponse.HeaderOp{Op: changeresponse.HeaderOpReplace, Name: "Location", Pattern: "("},
+			expected: "override 0: header operation 0: invalid pattern: error parsing regexp: missing closing ): `(`",
+		},
+		{
+			name:     "missing new name",
+			op:       changeresponse.HeaderOp{Op: changeresponse.HeaderOpRename, Name: "X-Foo"},
+			expected: "override 0: header operation 0: new header name is required for rename operation",
+		},
+		{
+			name:     "name and regex",
+			op:       changeresponse.HeaderOp{Op: changeresponse.HeaderOpRemove, Name: "X-Foo", NameRegex: "^X-"},
+			expected: "override 0: header operation 0: name and nameRegex are mutually exclusive",
+		},
+	}
+
+	for _, d := range datasets {
+		t.Run(d.name, func(t *testing.T) {
+			config := &changeresponse.Config{
+				Overrides: []changeresponse.Override{{From: []int{500}, To: 200, HeaderOps: []changeresponse.HeaderOp{d.op}}},
+			}
+
+			_, err := changeresponse.New(context.Background(), next, config, "test-plugin")
+			if err == nil || err.Error() != d.expected {
+				t.Errorf("Unexpected error\nactual:   %v\nexpected: %s", err, d.expected)
+			}
+		})
+	}
+}
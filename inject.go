@@ -0,0 +1,146 @@
+package traefik_change_response
+
+import (
+	"bytes"
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// Inject mode anchors
+const (
+	AnchorHeadStart = "<head>"
+	AnchorHeadEnd   = "</head>"
+	AnchorBodyStart = "<body>"
+	AnchorBodyEnd   = "</body>"
+)
+
+// htmlAnchor is a tag to insert contents before or after
+type htmlAnchor struct {
+	tag    string // lowercase tag name, closing tags start with /
+	before bool   // insert before the tag, after it otherwise
+}
+
+// injectAnchors lists tags to look for in order, so that missing anchors fall back to the nearest position
+var injectAnchors = map[string][]htmlAnchor{
+	AnchorHeadStart: {{tag: "head"}, {tag: "html"}},
+	AnchorHeadEnd:   {{tag: "/head", before: true}, {tag: "body", before: true}, {tag: "html"}},
+	AnchorBodyStart: {{tag: "body"}, {tag: "/head"}, {tag: "html"}},
+	AnchorBodyEnd:   {{tag: "/body", before: true}, {tag: "/html", before: true}},
+}
+
+// validateAnchor validates inject mode anchor and returns it in lowercase
+func validateAnchor(anchor string) (string, error) {
+	if anchor == "" {
+		return AnchorBodyEnd, nil
+	}
+
+	anchor = strings.ToLower(anchor)
+	if _, ok := injectAnchors[anchor]; !ok {
+		return "", fmt.Errorf("unsupported inject anchor: %s", anchor)
+	}
+
+	return anchor, nil
+}
+
+// isHTML checks if the response body is uncompressed HTML
+func isHTML(headers http.Header) bool {
+	if encoding := headers.Get("Content-Encoding"); encoding != "" && !strings.EqualFold(encoding, "identity") {
+		return false
+	}
+
+	mediaType, _, err := mime.ParseMediaType(headers.Get("Content-Type"))
+
+	return err == nil && (mediaType == "text/html" || mediaType == "application/xhtml+xml")
+}
+
+// injectBody inserts contents at the anchor of HTML body. Contents are added to the beginning of the body for
+// missing opening anchors and to the end of it for missing closing ones. Returns false if the body is not HTML
+func (s *responseState) injectBody(anchor string, contents string) bool {
+	if !isHTML(s.headers) {
+		return false
+	}
+
+	closing := anchor[1] == '/'
+
+	pos := -1
+	if s.spill == nil { // spilled bodies are not searched
+		pos = findAnchor(s.body.Bytes(), injectAnchors[anchor])
+	}
+
+	switch {
+	case pos >= 0:
+		s.insertBody(pos, contents)
+	case closing:
+		s.appendBody(contents)
+	default:
+		s.prependBody(contents)
+	}
+
+	return true
+}
+
+// findAnchor returns position to insert contents at for the first anchor found in HTML or -1
+func findAnchor(html []byte, anchors []htmlAnchor) int {
+	lower := make([]byte, len(html)) // tags are case-insensitive, ASCII lowercase keeps byte positions
+	for i, c := range html {
+		if 'A' <= c && c <= 'Z' {
+			c += 'a' - 'A'
+		}
+
+		lower[i] = c
+	}
+
+	for _, anchor := range anchors {
+		start, end := findTag(lower, anchor.tag)
+		if start < 0 {
+			continue
+		}
+
+		if anchor.before {
+			return start
+		}
+
+		return end
+	}
+
+	return -1
+}
+
+// findTag returns bounds of the first opening or the last closing tag in lowercase HTML or -1 if it is missing
+func findTag(html []byte, name string) (int, int) {
+	prefix := []byte("<" + name)
+	closing := name[0] == '/'
+	found := -1
+
+	for offset := 0; ; {
+		i := bytes.Index(html[offset:], prefix)
+		if i < 0 {
+			break
+		}
+
+		i += offset
+		offset = i + len(prefix)
+
+		if offset < len(html) && !bytes.ContainsAny(html[offset:offset+1], " \t\r\n/>") {
+			continue // other tag with the same prefix, e.g. <header>
+		}
+
+		found = i
+		if !closing {
+			break
+		}
+	}
+
+	if found < 0 {
+		return -1, -1
+	}
+
+	end := bytes.IndexByte(html[found:], '>')
+	if end < 0 {
+		return -1, -1
+	}
+
+	return found, found + end + 1
+}
@@ -0,0 +1,152 @@
+package traefik_change_response_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	changeresponse "github.com/bravepickle/traefik-change-response"
+)
+
+func TestInject(t *testing.T) {
+	page := `<!DOCTYPE html><HTML lang="en"><Head><title>Shop</title></HEAD>` +
+		`<body class="main"><header>Shop</header><p>Items</p></Body></html>`
+	snippet := `<div class="banner">Degraded service</div>`
+	html := http.Header{"Content-Type": []string{"text/html; charset=utf-8"}}
+
+	datasets := []struct {
+		name     string
+		anchor   string
+		headers  http.Header
+		body     string
+		expected string
+	}{
+		{
+			name:    "before closing body by default",
+			headers: html,
+			body:    page,
+			expected: `<!DOCTYPE html><HTML lang="en"><Head><title>Shop</title></HEAD>` +
+				`<body class="main"><header>Shop</header><p>Items</p>` + snippet + `</Body></html>`,
+		},
+		{
+			name:    "after opening body",
+			anchor:  changeresponse.AnchorBodyStart,
+			headers: html,
+			body:    page,
+			expected: `<!DOCTYPE html><HTML lang="en"><Head><title>Shop</title></HEAD>` +
+				`<body class="main">` + snippet + `<header>Shop</header><p>Items</p></Body></html>`,
+		},
+		{
+			name:    "after opening head",
+			anchor:  "<HEAD>",
+			headers: html,
+			body:    page,
+			expected: `<!DOCTYPE html><HTML lang="en"><Head>` + snippet + `<title>Shop</title></HEAD>` +
+				`<body class="main"><header>Shop</header><p>Items</p></Body></html>`,
+		},
+		{
+			name:    "before closing head",
+			anchor:  changeresponse.AnchorHeadEnd,
+			headers: html,
+			body:    page,
+			expected: `<!DOCTYPE html><HTML lang="en"><Head><title>Shop</title>` + snippet + `</HEAD>` +
+				`<body class="main"><header>Shop</header><p>Items</p></Body></html>`,
+		},
+		{
+			name:     "missing head falls back to html",
+			anchor:   changeresponse.AnchorHeadStart,
+			headers:  html,
+			body:     `<html><p>Items</p></html>`,
+			expected: `<html>` + snippet + `<p>Items</p></html>`,
+		},
+		{
+			name:     "missing closing body falls back to closing html",
+			headers:  html,
+			body:     `<html><p>Items</p></html>`,
+			expected: `<html><p>Items</p>` + snippet + `</html>`,
+		},
+		{
+			name:     "fragment",
+			headers:  html,
+			body:     `<p>Items</p>`,
+			expected: `<p>Items</p>` + snippet,
+		},
+		{
+			name:     "fragment with opening anchor",
+			anchor:   changeresponse.AnchorBodyStart,
+			headers:  html,
+			body:     `<p>Items</p>`,
+			expected: snippet + `<p>Items</p>`,
+		},
+		{
+			name:     "not html",
+			headers:  http.Header{"Content-Type": []string{"application/json"}},
+			body:     `{"body":"</body>"}`,
+			expected: `{"body":"</body>"}`,
+		},
+		{
+			name: "compressed html",
+			headers: http.Header{
+				"Content-Type":     []string{"text/html"},
+				"Content-Encoding": []string{"gzip"},
+			},
+			body:     page,
+			expected: page,
+		},
+	}
+
+	for _, d := range datasets {
+		t.Run(d.name, func(t *testing.T) {
+			recorder := servePlugin(t, inputDataset{
+				config: changeresponse.Config{
+					Overrides: []changeresponse.Override{{
+						From:   []int{503},
+						To:     200,
+						Body:   snippet,
+						Mode:   changeresponse.ModeInject,
+						Anchor: d.anchor,
+					}},
+				},
+				responseCode:    http.StatusServiceUnavailable,
+				responseHeaders: d.headers,
+				responseBody:    d.body,
+			})
+
+			if actual := recorder.Body.String(); actual != d.expected {
+				t.Errorf("Body mismatch\nactual:   %s\nexpected: %s", actual, d.expected)
+			}
+		})
+	}
+}
+
+func TestInjectConfig(t *testing.T) {
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {})
+
+	datasets := []struct {
+		name     string
+		override changeresponse.Override
+		expected string
+	}{
+		{
+			name:     "unsupported anchor",
+			override: changeresponse.Override{From: []int{500}, To: 200, Mode: changeresponse.ModeInject, Anchor: "<footer>"},
+			expected: "override 0: unsupported inject anchor: <footer>",
+		},
+		{
+			name:     "anchor without inject mode",
+			override: changeresponse.Override{From: []int{500}, To: 200, Anchor: changeresponse.AnchorBodyEnd},
+			expected: "override 0: anchor is supported only in inject mode",
+		},
+	}
+
+	for _, d := range datasets {
+		t.Run(d.name, func(t *testing.T) {
+			config := &changeresponse.Config{Overrides: []changeresponse.Override{d.override}}
+
+			_, err := changeresponse.New(context.Background(), next, config, "test-plugin")
+			if err == nil || err.Error() != d.expected {
+				t.Errorf("Unexpected error\nactual:   %v\nexpected: %s", err, d.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,122 @@
+package traefik_change_response
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Integrity headers handling
+const (
+	IntegrityDrop      = "drop"
+	IntegrityRecompute = "recompute"
+)
+
+// digestHeaders describe upstream body and are stale once it is modified
+var digestHeaders = []string{"Content-Md5", "Digest", "Content-Digest", "Repr-Digest"}
+
+// Integrity defines handling of headers describing the body modified by override rules
+type Integrity struct {
+	// ETag handling of validators stripped by rules with auto cache validators. Optional
+	// Allowed:
+	//   drop (default) - send no ETag
+	//   recompute - set strong ETag from the modified body hash and answer If-None-Match requests with 304
+	ETag string `json:"etag,omitempty"`
+
+	// Digest handling of Content-MD5, Digest, Content-Digest and Repr-Digest headers. Optional
+	// Allowed:
+	//   drop (default) - remove the headers
+	//   recompute - remove the headers and set RFC 9530 Content-Digest with sha-256 of the modified body
+	Digest string `json:"digest,omitempty"`
+}
+
+// validateIntegrity validates integrity headers handling and sets defaults
+func validateIntegrity(c *Integrity) error {
+	for _, mode := range []*string{&c.ETag, &c.Digest} {
+		switch *mode {
+		case "":
+			*mode = IntegrityDrop
+		case IntegrityDrop, IntegrityRecompute:
+		default:
+			return fmt.Errorf("unsupported handling: %s", *mode)
+		}
+	}
+
+	return nil
+}
+
+// defaultIntegrity drops headers describing upstream body
+var defaultIntegrity = &Integrity{ETag: IntegrityDrop, Digest: IntegrityDrop}
+
+// applyIntegrity drops or recomputes headers describing the body modified by override rules. Returns recomputed ETag
+func (s *responseState) applyIntegrity(c *Integrity) string {
+	if !s.bodyChanged {
+		return ""
+	}
+
+	if c == nil {
+		c = defaultIntegrity
+	}
+
+	for _, name := range digestHeaders {
+		s.headers.Del(name)
+	}
+
+	validators := ValidatorsAuto
+	if s.cache != nil {
+		validators = s.cache.Validators
+	}
+
+	recomputeETag := c.ETag == IntegrityRecompute && validators == ValidatorsAuto
+	if !recomputeETag && c.Digest != IntegrityRecompute {
+		return ""
+	}
+
+	h := sha256.New()
+	_, _ = s.writeBody(h)
+	sum := h.Sum(nil)
+
+	if c.Digest == IntegrityRecompute {
+		s.headers.Set("Content-Digest", "sha-256=:"+base64.StdEncoding.EncodeToString(sum)+":")
+	}
+
+	if !recomputeETag {
+		return ""
+	}
+
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+	s.headers.Set("ETag", etag)
+
+	return etag
+}
+
+// notModified answers conditional request with 304 if its If-None-Match matches the response ETag
+func (s *responseState) notModified(req *http.Request, etag string) {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		return
+	}
+
+	if s.status/100 != 2 || !etagMatches(req.Header.Values("If-None-Match"), etag) {
+		return // conditions are evaluated only for successful responses
+	}
+
+	s.status = http.StatusNotModified
+	s.replaceBody("")
+}
+
+// etagMatches checks If-None-Match header values against ETag using weak comparison
+func etagMatches(values []string, etag string) bool {
+	for _, value := range values {
+		for _, tag := range strings.Split(value, ",") {
+			tag = strings.TrimSpace(tag)
+			if tag == "*" || strings.TrimPrefix(tag, "W/") == etag {
+				return true
+			}
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,161 @@
+package traefik_change_response_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	changeresponse "github.com/bravepickle/traefik-change-response"
+)
+
+func TestIntegrity(t *testing.T) {
+	upstream := http.Header{
+		"Etag":           []string{`"v1"`},
+		"Content-Md5":    []string{"Q2hlY2sgSW50ZWdyaXR5IQ=="},
+		"Digest":         []string{"sha-256=X48E9qOokqqrvdts8nOJRJN3OWDUoyWxBf7kbu9DBPE="},
+		"Content-Digest": []string{"sha-256=:X48E9qOokqqrvdts8nOJRJN3OWDUoyWxBf7kbu9DBPE=:"},
+	}
+
+	body := "Everything is fine"
+	sum := sha256.Sum256([]byte(body))
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+	digest := "sha-256=:" + base64.StdEncoding.EncodeToString(sum[:]) + ":"
+
+	datasets := []struct {
+		name      string
+		integrity *changeresponse.Integrity
+		mode      string
+		expected  map[string]string
+	}{
+		{
+			name: "dropped by default",
+			expected: map[string]string{
+				"Etag":           "",
+				"Content-Md5":    "",
+				"Digest":         "",
+				"Content-Digest": "",
+			},
+		},
+		{
+			name:      "recomputed",
+			integrity: &changeresponse.Integrity{ETag: changeresponse.IntegrityRecompute, Digest: changeresponse.IntegrityRecompute},
+			expected: map[string]string{
+				"Etag":           etag,
+				"Content-Md5":    "",
+				"Digest":         "",
+				"Content-Digest": digest,
+			},
+		},
+		{
+			name:      "body kept",
+			integrity: &changeresponse.Integrity{ETag: changeresponse.IntegrityRecompute, Digest: changeresponse.IntegrityRecompute},
+			mode:      changeresponse.ModeKeep,
+			expected: map[string]string{
+				"Etag":           `"v1"`,
+				"Content-Md5":    "Q2hlY2sgSW50ZWdyaXR5IQ==",
+				"Content-Digest": "sha-256=:X48E9qOokqqrvdts8nOJRJN3OWDUoyWxBf7kbu9DBPE=:",
+			},
+		},
+	}
+
+	for _, d := range datasets {
+		t.Run(d.name, func(t *testing.T) {
+			responseBody := "Some error"
+			if d.mode == changeresponse.ModeKeep {
+				responseBody = body
+			}
+
+			recorder := servePlugin(t, inputDataset{
+				config: changeresponse.Config{
+					Overrides: []changeresponse.Override{{From: []int{500}, To: 200, Body: body, Mode: d.mode}},
+					Integrity: d.integrity,
+				},
+				responseCode:    http.StatusInternalServerError,
+				responseHeaders: upstream,
+				responseBody:    responseBody,
+			})
+
+			for name, expected := range d.expected {
+				if actual := recorder.Header().Get(name); actual != expected {
+					t.Errorf("%s header mismatch: got %q, want %q", name, actual, expected)
+				}
+			}
+		})
+	}
+}
+
+func TestIntegrityNotModified(t *testing.T) {
+	handler := newPluginHandler(t, inputDataset{
+		config: changeresponse.Config{
+			Overrides: []changeresponse.Override{{From: []int{500}, To: 200, Body: "Everything is fine"}},
+			Integrity: &changeresponse.Integrity{ETag: changeresponse.IntegrityRecompute},
+		},
+		responseCode: http.StatusInternalServerError,
+		responseBody: "Some error",
+	})
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "http://localhost", nil))
+
+	etag := recorder.Header().Get("ETag")
+	if recorder.Code != http.StatusOK || etag == "" {
+		t.Fatalf("Unexpected response: %d, ETag %q", recorder.Code, etag)
+	}
+
+	datasets := []struct {
+		name        string
+		method      string
+		ifNoneMatch string
+		expected    int
+	}{
+		{name: "matching", method: http.MethodGet, ifNoneMatch: `"other", W/` + etag, expected: http.StatusNotModified},
+		{name: "any", method: http.MethodHead, ifNoneMatch: "*", expected: http.StatusNotModified},
+		{name: "not matching", method: http.MethodGet, ifNoneMatch: `"other"`, expected: http.StatusOK},
+		{name: "unsafe method", method: http.MethodPost, ifNoneMatch: etag, expected: http.StatusOK},
+	}
+
+	for _, d := range datasets {
+		t.Run(d.name, func(t *testing.T) {
+			req := httptest.NewRequest(d.method, "http://localhost", nil)
+			req.Header.Set("If-None-Match", d.ifNoneMatch)
+
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, req)
+
+			if recorder.Code != d.expected {
+				t.Errorf("Status code mismatch: got %d, want %d", recorder.Code, d.expected)
+			}
+
+			if recorder.Code != http.StatusNotModified {
+				return
+			}
+
+			if recorder.Body.Len() != 0 || recorder.Header().Get("Content-Length") != "" {
+				t.Errorf("Unexpected body of not modified response: %q", recorder.Body.String())
+			}
+
+			if actual := recorder.Header().Get("ETag"); actual != etag {
+				t.Errorf("ETag mismatch: got %q, want %q", actual, etag)
+			}
+		})
+	}
+}
+
+func TestIntegrityConfig(t *testing.T) {
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {})
+	config := &changeresponse.Config{
+		Overrides: []changeresponse.Override{{From: []int{500}, To: 200}},
+		Integrity: &changeresponse.Integrity{Digest: "md5"},
+	}
+
+	_, err := changeresponse.New(context.Background(), next, config, "test-plugin")
+
+	expected := "integrity: unsupported handling: md5"
+	if err == nil || err.Error() != expected {
+		t.Errorf("Unexpected error\nactual:   %v\nexpected: %s", err, expected)
+	}
+}
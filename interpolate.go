@@ -0,0 +1,156 @@
+package traefik_change_response
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+const filePrefix = "file:"
+
+// interpolateConfig resolves ${VAR}, ${VAR:-default} and ${file:/path} references in all string values of the config.
+// Undefined variables resolve to empty string unless strict mode is enabled
+func interpolateConfig(config *Config) error {
+	return interpolateValue(reflect.ValueOf(config).Elem(), "config", config.StrictEnv)
+}
+
+// interpolateValue resolves references in string values reachable from the value
+func interpolateValue(v reflect.Value, path string, strict bool) error {
+	switch v.Kind() {
+	case reflect.String:
+		resolved, err := interpolate(v.String(), strict)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+
+		v.SetString(resolved)
+	case reflect.Pointer:
+		if !v.IsNil() {
+			return interpolateValue(v.Elem(), path, strict)
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+			if !field.IsExported() {
+				continue
+			}
+
+			name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+			if name == "" {
+				name = field.Name
+			}
+
+			if err := interpolateValue(v.Field(i), path+"."+name, strict); err != nil {
+				return err
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if err := interpolateValue(v.Index(i), path+"["+strconv.Itoa(i)+"]", strict); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		iter := v.MapRange()
+		for iter.Next() {
+			// map values are not addressable, resolve a copy and put it back
+			value := reflect.New(iter.Value().Type()).Elem()
+			value.Set(iter.Value())
+
+			if err := interpolateValue(value, path+"."+fmt.Sprint(iter.Key()), strict); err != nil {
+				return err
+			}
+
+			v.SetMapIndex(iter.Key(), value)
+		}
+	}
+
+	return nil
+}
+
+// interpolate resolves references in the string. $${ is an escaped ${. References with names that are not valid
+// variable names are kept as is
+func interpolate(s string, strict bool) (string, error) {
+	if !strings.Contains(s, "${") {
+		return s, nil
+	}
+
+	var b strings.Builder
+
+	for {
+		start := strings.Index(s, "${")
+		if start < 0 {
+			break
+		}
+
+		if start > 0 && s[start-1] == '$' {
+			b.WriteString(s[:start-1] + "${")
+			s = s[start+2:]
+
+			continue
+		}
+
+		end := strings.IndexByte(s[start:], '}')
+		if end < 0 {
+			break
+		}
+
+		end += start
+		expr := s[start+2 : end]
+		b.WriteString(s[:start])
+		s = s[end+1:]
+
+		name, defaultValue, hasDefault := strings.Cut(expr, ":-")
+
+		if path, ok := strings.CutPrefix(name, filePrefix); ok {
+			data, err := os.ReadFile(path)
+			switch {
+			case err == nil:
+				b.WriteString(strings.TrimRight(string(data), "\r\n")) // files usually end with a line break
+			case hasDefault:
+				b.WriteString(defaultValue)
+			default:
+				return "", fmt.Errorf("cannot read %s: %w", path, err)
+			}
+
+			continue
+		}
+
+		if !isVariableName(name) {
+			b.WriteString("${" + expr + "}")
+
+			continue
+		}
+
+		value, ok := os.LookupEnv(name)
+		switch {
+		case value != "":
+			b.WriteString(value)
+		case hasDefault:
+			b.WriteString(defaultValue)
+		case !ok && strict:
+			return "", fmt.Errorf("undefined variable %s", name)
+		}
+	}
+
+	b.WriteString(s)
+
+	return b.String(), nil
+}
+
+// isVariableName checks if name is a valid environment variable name
+func isVariableName(name string) bool {
+	if name == "" || (name[0] >= '0' && name[0] <= '9') {
+		return false
+	}
+
+	for _, c := range name {
+		if c != '_' && (c < 'a' || c > 'z') && (c < 'A' || c > 'Z') && (c < '0' || c > '9') {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,110 @@
+package traefik_change_response_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	changeresponse "github.com/bravepickle/traefik-change-response"
+)
+
+func TestInterpolation(t *testing.T) {
+	t.Setenv("SUPPORT_EMAIL", "support@example.com")
+	t.Setenv("EMPTY_VAR", "")
+
+	secret := filepath.Join(t.TempDir(), "secret")
+	if err := os.WriteFile(secret, []byte("s3cr3t\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	d := inputDataset{
+		config: changeresponse.Config{
+			Overrides: []changeresponse.Override{{
+				From: []int{500},
+				To:   503,
+				Headers: http.Header{
+					"X-Status-Page": []string{"${STATUS_PAGE_URL:-https://status.example.com}"},
+					"X-Token":       []string{"${file:" + secret + "}"},
+					"X-Missing":     []string{"${file:" + secret + ".missing:-none}"},
+				},
+				Body: "Contact ${SUPPORT_EMAIL}${UNDEFINED_VAR}${EMPTY_VAR:-} ${1} $${SUPPORT_EMAIL}",
+			}},
+		},
+		responseCode: 500,
+		responseBody: "Some error",
+	}
+
+	recorder := servePlugin(t, d)
+
+	expectedBody := "Contact support@example.com ${1} ${SUPPORT_EMAIL}"
+	if recorder.Body.String() != expectedBody {
+		t.Errorf("Body mismatch\nactual:   %s\nexpected: %s", recorder.Body.String(), expectedBody)
+	}
+
+	expectedHeaders := map[string]string{
+		"X-Status-Page": "https://status.example.com",
+		"X-Token":       "s3cr3t",
+		"X-Missing":     "none",
+	}
+
+	for name, expected := range expectedHeaders {
+		if actual := recorder.Header().Get(name); actual != expected {
+			t.Errorf("%s header mismatch: got %q, want %q", name, actual, expected)
+		}
+	}
+}
+
+func TestInterpolationErrors(t *testing.T) {
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {})
+	missing := filepath.Join(t.TempDir(), "missing")
+
+	datasets := []struct {
+		name     string
+		config   *changeresponse.Config
+		expected string
+	}{
+		{
+			name: "strict undefined variable",
+			config: &changeresponse.Config{
+				Overrides: []changeresponse.Override{{From: []int{500}, To: 200, Body: "${UNDEFINED_VAR}"}},
+				StrictEnv: true,
+			},
+			expected: "config.overrides[0].body: undefined variable UNDEFINED_VAR",
+		},
+		{
+			name: "missing file",
+			config: &changeresponse.Config{
+				Overrides: []changeresponse.Override{{From: []int{500}, To: 200}},
+				Fault:     &changeresponse.Fault{Header: "X-Fault", Secret: "${file:" + missing + "}"},
+			},
+			expected: "config.fault.secret: cannot read " + missing + ": open " + missing + ": no such file or directory",
+		},
+	}
+
+	for _, d := range datasets {
+		t.Run(d.name, func(t *testing.T) {
+			_, err := changeresponse.New(context.Background(), next, d.config, "test-plugin")
+			if err == nil || err.Error() != d.expected {
+				t.Errorf("Unexpected error\nactual:   %v\nexpected: %s", err, d.expected)
+			}
+		})
+	}
+}
+
+func TestInterpolationRulesFile(t *testing.T) {
+	t.Setenv("SUPPORT_EMAIL", "support@example.com")
+
+	path := filepath.Join(t.TempDir(), "rules.json")
+	writeRulesFile(t, path, `{"overrides": [{"from": [500], "to": 200, "body": "Contact ${SUPPORT_EMAIL}"}]}`)
+
+	handler := newRulesFileHandler(t, context.Background(), path)
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "http://localhost", nil))
+
+	if expected := "Contact support@example.com"; recorder.Body.String() != expected {
+		t.Errorf("Body mismatch\nactual:   %s\nexpected: %s", recorder.Body.String(), expected)
+	}
+}
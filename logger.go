@@ -0,0 +1,252 @@
+package traefik_change_response
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LogLevel is a log record severity
+type LogLevel int
+
+// Log levels
+const (
+	LevelDebug LogLevel = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+// Log formats
+const (
+	LogFormatJSON   = "json"
+	LogFormatLogfmt = "logfmt"
+)
+
+// LogOutput destination of debug and info log records. Can be replaced, e.g. in tests
+var LogOutput io.Writer = os.Stdout
+
+// LogErrorOutput destination of warning and error log records. Can be replaced, e.g. in tests
+var LogErrorOutput io.Writer = os.Stderr
+
+// String returns level name
+func (l LogLevel) String() string {
+	switch l {
+	case LevelDebug:
+		return "debug"
+	case LevelInfo:
+		return "info"
+	case LevelWarn:
+		return "warn"
+	case LevelError:
+		return "error"
+	default:
+		return "level(" + strconv.Itoa(int(l)) + ")"
+	}
+}
+
+// parseLogLevel converts level name to log level
+func parseLogLevel(name string) (LogLevel, error) {
+	for l := LevelDebug; l <= LevelError; l++ {
+		if strings.EqualFold(name, l.String()) {
+			return l, nil
+		}
+	}
+
+	return LevelInfo, fmt.Errorf("unsupported log level: %s", name)
+}
+
+// LogRecord is a single structured log entry. Empty fields are omitted from the output
+type LogRecord struct {
+	Time      time.Time
+	Level     LogLevel
+	Plugin    string
+	Message   string
+	RequestID string
+	Rules     []int // indexes of applied override rules
+	Status    int   // original response status code
+	NewStatus int   // status code sent to the client
+	Duration  time.Duration
+	BodySize  int
+	Body      string
+	Error     string
+	Fields    map[string]string // extra record fields
+}
+
+// Logger writes structured log records
+type Logger interface {
+	Log(record *LogRecord)
+}
+
+// StreamLogger writes log records to the output streams, one record per line
+type StreamLogger struct {
+	mu     sync.Mutex
+	out    io.Writer
+	errOut io.Writer
+	format string
+}
+
+// NewStreamLogger creates logger writing records in JSON or logfmt format. Warnings and errors are written to errOut
+func NewStreamLogger(out io.Writer, errOut io.Writer, format string) (*StreamLogger, error) {
+	switch format {
+	case LogFormatJSON, LogFormatLogfmt:
+	case "":
+		format = LogFormatJSON
+	default:
+		return nil, fmt.Errorf("unsupported log format: %s", format)
+	}
+
+	return &StreamLogger{out: out, errOut: errOut, format: format}, nil
+}
+
+// Log writes log record
+func (l *StreamLogger) Log(record *LogRecord) {
+	var buf bytes.Buffer
+
+	if l.format == LogFormatLogfmt {
+		encodeLogfmt(&buf, record)
+	} else {
+		encodeJSON(&buf, record)
+	}
+
+	buf.WriteByte('\n')
+
+	out := l.out
+	if record.Level >= LevelWarn {
+		out = l.errOut
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	_, _ = out.Write(buf.Bytes())
+}
+
+// logField is a single key-value pair of the record
+type logField struct {
+	key    string
+	value  string
+	number bool // value is written without quotes in JSON
+}
+
+// fields lists non-empty record fields in output order
+func (r *LogRecord) fields() []logField {
+	fields := []logField{
+		{key: "time", value: r.Time.Format(time.RFC3339Nano)},
+		{key: "level", value: r.Level.String()},
+		{key: "plugin", value: r.Plugin},
+		{key: "msg", value: r.Message},
+	}
+
+	if r.RequestID != "" {
+		fields = append(fields, logField{key: "requestId", value: r.RequestID})
+	}
+
+	if len(r.Rules) > 0 {
+		rules := make([]string, len(r.Rules))
+		for i, rule := range r.Rules {
+			rules[i] = strconv.Itoa(rule)
+		}
+
+		fields = append(fields, logField{key: "rules", value: strings.Join(rules, ",")})
+	}
+
+	if r.Status != 0 {
+		fields = append(fields, logField{key: "status", value: strconv.Itoa(r.Status), number: true})
+	}
+
+	if r.NewStatus != 0 {
+		fields = append(fields, logField{key: "newStatus", value: strconv.Itoa(r.NewStatus), number: true})
+	}
+
+	if r.Duration != 0 {
+		fields = append(fields, logField{key: "duration", value: r.Duration.String()})
+	}
+
+	if r.BodySize != 0 {
+		fields = append(fields, logField{key: "bodySize", value: strconv.Itoa(r.BodySize), number: true})
+	}
+
+	if r.Body != "" {
+		fields = append(fields, logField{key: "body", value: r.Body})
+	}
+
+	if r.Error != "" {
+		fields = append(fields, logField{key: "error", value: r.Error})
+	}
+
+	keys := make([]string, 0, len(r.Fields))
+	for k := range r.Fields {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		fields = append(fields, logField{key: k, value: r.Fields[k]})
+	}
+
+	return fields
+}
+
+// encodeJSON writes record as a JSON object
+func encodeJSON(buf *bytes.Buffer, record *LogRecord) {
+	buf.WriteByte('{')
+
+	for i, f := range record.fields() {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+
+		key, _ := json.Marshal(f.key)
+		buf.Write(key)
+		buf.WriteByte(':')
+
+		if f.number {
+			buf.WriteString(f.value)
+		} else {
+			value, _ := json.Marshal(f.value)
+			buf.Write(value)
+		}
+	}
+
+	buf.WriteByte('}')
+}
+
+// encodeLogfmt writes record as logfmt key=value pairs
+func encodeLogfmt(buf *bytes.Buffer, record *LogRecord) {
+	for i, f := range record.fields() {
+		if i > 0 {
+			buf.WriteByte(' ')
+		}
+
+		buf.WriteString(f.key)
+		buf.WriteByte('=')
+
+		if f.value == "" || strings.ContainsAny(f.value, " =\"\\") || strconv.Quote(f.value) != `"`+f.value+`"` {
+			buf.WriteString(strconv.Quote(f.value))
+		} else {
+			buf.WriteString(f.value)
+		}
+	}
+}
+
+// truncateLogBody cuts body to be logged to the limit. Bodies are not logged with zero limit
+func truncateLogBody(body []byte, limit int) string {
+	if limit <= 0 {
+		return ""
+	}
+
+	if len(body) > limit {
+		return string(body[:limit]) + "..."
+	}
+
+	return string(body)
+}
@@ -0,0 +1,126 @@
+package traefik_change_response_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	changeresponse "github.com/bravepickle/traefik-change-response"
+)
+
+func TestLogger(t *testing.T) {
+	datasets := []struct {
+		name     string
+		config   changeresponse.Config
+		expected []string
+	}{
+		{
+			name: "json",
+			config: changeresponse.Config{
+				Overrides:    []changeresponse.Override{{From: []int{500}, To: 200, Body: "Everything is fine"}},
+				LogLevel:     "debug",
+				LogBodyLimit: 10,
+			},
+			expected: []string{
+				`"level":"debug"`,
+				`"plugin":"test-plugin"`,
+				`"msg":"response processed"`,
+				`"requestId":"req-1"`,
+				`"rules":"0"`,
+				`"status":500`,
+				`"newStatus":200`,
+				`"bodySize":18`,
+				`"body":"Everything..."`,
+			},
+		},
+		{
+			name: "logfmt",
+			config: changeresponse.Config{
+				Overrides: []changeresponse.Override{{From: []int{500}, To: 200, Body: "Everything is fine"}},
+				Debug:     true,
+				LogFormat: changeresponse.LogFormatLogfmt,
+			},
+			expected: []string{
+				`level=debug plugin=test-plugin msg="response processed" requestId=req-1 rules=0 status=500 newStatus=200`,
+				`bodySize=18`,
+			},
+		},
+	}
+
+	for _, d := range datasets {
+		t.Run(d.name, func(t *testing.T) {
+			outBuf := bytes.NewBuffer([]byte{})
+			captureLogs(t, outBuf, bytes.NewBuffer([]byte{}))
+
+			next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+				rw.WriteHeader(http.StatusInternalServerError)
+			})
+
+			handler, err := changeresponse.New(context.Background(), next, &d.config, "test-plugin")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			outBuf.Reset()
+
+			req := httptest.NewRequest(http.MethodGet, "http://localhost", nil)
+			req.Header.Set("X-Request-Id", "req-1")
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+
+			lines := strings.Split(strings.TrimSuffix(outBuf.String(), "\n"), "\n")
+			if len(lines) != 1 {
+				t.Fatalf("Expected single log record, got: %s", outBuf.String())
+			}
+
+			if d.config.LogFormat == "" && !json.Valid([]byte(lines[0])) {
+				t.Errorf("Invalid JSON log record: %s", lines[0])
+			}
+
+			for _, e := range d.expected {
+				if !strings.Contains(lines[0], e) {
+					t.Errorf("Log record mismatch\nactual:   %s\nexpected: %s", lines[0], e)
+				}
+			}
+
+			if d.config.LogBodyLimit == 0 && strings.Contains(lines[0], "Everything") {
+				t.Errorf("Body must not be logged by default: %s", lines[0])
+			}
+		})
+	}
+}
+
+func TestLoggerLevel(t *testing.T) {
+	outBuf := bytes.NewBuffer([]byte{})
+	captureLogs(t, outBuf, bytes.NewBuffer([]byte{}))
+
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {})
+	config := &changeresponse.Config{
+		Overrides: []changeresponse.Override{{From: []int{200}, To: 200}},
+		Debug:     true,
+		LogLevel:  "warn",
+	}
+
+	handler, err := changeresponse.New(context.Background(), next, config, "test-plugin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "http://localhost", nil))
+
+	if outBuf.Len() != 0 {
+		t.Errorf("Unexpected log records below warn level: %s", outBuf.String())
+	}
+
+	for _, c := range []changeresponse.Config{
+		{Overrides: config.Overrides, LogLevel: "verbose"},
+		{Overrides: config.Overrides, LogFormat: "xml"},
+	} {
+		if _, err := changeresponse.New(context.Background(), next, &c, "test-plugin"); err == nil {
+			t.Errorf("Expected configuration error for log level %q and format %q", c.LogLevel, c.LogFormat)
+		}
+	}
+}
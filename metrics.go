@@ -0,0 +1,240 @@
+package traefik_change_response
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const metricsPrefix = "changeresponse_"
+
+var (
+	bodyBytesBuckets  = []float64{256, 1024, 4096, 16384, 65536, 262144, 1048576, 4194304}
+	processingBuckets = []float64{0.0001, 0.0005, 0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1}
+)
+
+// Metrics collects plugin statistics and exposes them in Prometheus text format
+type Metrics struct {
+	plugin string
+
+	mu          sync.Mutex
+	requests    uint64
+	ruleMatches map[ruleKey]uint64
+	transitions map[statusTransition]uint64
+	bodyBefore  *histogram
+	bodyAfter   *histogram
+	processing  *histogram
+}
+
+// ruleKey identifies override rule
+type ruleKey struct {
+	index int
+	name  string
+}
+
+// statusTransition is a status code change made by override rules
+type statusTransition struct {
+	from int
+	to   int
+}
+
+// histogram counts observations in cumulative buckets
+type histogram struct {
+	bounds []float64
+	counts []uint64 // per bucket, the last one is +Inf
+	sum    float64
+	count  uint64
+}
+
+// newMetrics creates metrics for the plugin
+func newMetrics(plugin string) *Metrics {
+	return &Metrics{
+		plugin:      plugin,
+		ruleMatches: make(map[ruleKey]uint64),
+		transitions: make(map[statusTransition]uint64),
+		bodyBefore:  newHistogram(bodyBytesBuckets),
+		bodyAfter:   newHistogram(bodyBytesBuckets),
+		processing:  newHistogram(processingBuckets),
+	}
+}
+
+// newHistogram creates histogram with the bucket upper bounds
+func newHistogram(bounds []float64) *histogram {
+	return &histogram{bounds: bounds, counts: make([]uint64, len(bounds)+1)}
+}
+
+// observe adds value to the histogram
+func (h *histogram) observe(value float64) {
+	i := sort.SearchFloat64s(h.bounds, value)
+	h.counts[i]++
+	h.sum += value
+	h.count++
+}
+
+// countRequest registers request seen by the plugin
+func (m *Metrics) countRequest() {
+	m.mu.Lock()
+	m.requests++
+	m.mu.Unlock()
+}
+
+// observeResponse registers processed response
+func (m *Metrics) observeResponse(
+	set *ruleSet,
+	rules []int,
+	from int,
+	to int,
+	sizeBefore int,
+	sizeAfter int,
+	elapsed time.Duration,
+) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, rule := range rules {
+		m.ruleMatches[ruleKey{index: rule, name: set.rules[rule].Name}]++
+	}
+
+	if len(rules) > 0 {
+		m.transitions[statusTransition{from: from, to: to}]++
+	}
+
+	m.bodyBefore.observe(float64(sizeBefore))
+	m.bodyAfter.observe(float64(sizeAfter))
+	m.processing.observe(elapsed.Seconds())
+}
+
+// ServeHTTP responds with metrics in Prometheus text format
+func (m *Metrics) ServeHTTP(rw http.ResponseWriter, _ *http.Request) {
+	rw.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	rw.WriteHeader(http.StatusOK)
+
+	_, _ = m.WriteTo(rw)
+}
+
+// WriteTo writes metrics in Prometheus text format
+func (m *Metrics) WriteTo(w io.Writer) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	cw := &countingWriter{w: w}
+	out := bufio.NewWriter(cw)
+	plugin := `plugin="` + escapeLabel(m.plugin) + `"`
+
+	writeMetricHeader(out, "requests_total", "counter", "Total number of requests seen by the plugin.")
+	fmt.Fprintf(out, "%srequests_total{%s} %d\n", metricsPrefix, plugin, m.requests)
+
+	writeMetricHeader(out, "rule_matches_total", "counter", "Total number of responses matched by override rule.")
+	rules := make([]ruleKey, 0, len(m.ruleMatches))
+	for rule := range m.ruleMatches {
+		rules = append(rules, rule)
+	}
+
+	sort.Slice(rules, func(i, j int) bool {
+		if rules[i].index != rules[j].index {
+			return rules[i].index < rules[j].index
+		}
+
+		return rules[i].name < rules[j].name
+	})
+
+	for _, rule := range rules {
+		fmt.Fprintf(
+			out,
+			"%srule_matches_total{%s,rule=\"%d\",name=\"%s\"} %d\n",
+			metricsPrefix,
+			plugin,
+			rule.index,
+			escapeLabel(rule.name),
+			m.ruleMatches[rule],
+		)
+	}
+
+	writeMetricHeader(out, "status_transitions_total", "counter", "Total number of status code changes made by override rules.")
+	transitions := make([]statusTransition, 0, len(m.transitions))
+	for t := range m.transitions {
+		transitions = append(transitions, t)
+	}
+
+	sort.Slice(transitions, func(i, j int) bool {
+		if transitions[i].from != transitions[j].from {
+			return transitions[i].from < transitions[j].from
+		}
+
+		return transitions[i].to < transitions[j].to
+	})
+
+	for _, t := range transitions {
+		fmt.Fprintf(
+			out,
+			"%sstatus_transitions_total{%s,from=\"%d\",to=\"%d\"} %d\n",
+			metricsPrefix,
+			plugin,
+			t.from,
+			t.to,
+			m.transitions[t],
+		)
+	}
+
+	writeMetricHeader(out, "body_bytes", "histogram", "Response body size before and after processing.")
+	writeHistogram(out, "body_bytes", plugin+`,stage="before"`, m.bodyBefore)
+	writeHistogram(out, "body_bytes", plugin+`,stage="after"`, m.bodyAfter)
+
+	writeMetricHeader(out, "processing_seconds", "histogram", "Time spent processing responses by the plugin.")
+	writeHistogram(out, "processing_seconds", plugin, m.processing)
+
+	err := out.Flush()
+
+	return cw.n, err
+}
+
+// writeMetricHeader writes metric help and type lines
+func writeMetricHeader(out io.Writer, name string, kind string, help string) {
+	fmt.Fprintf(out, "# HELP %s%s %s\n# TYPE %s%s %s\n", metricsPrefix, name, help, metricsPrefix, name, kind)
+}
+
+// writeHistogram writes histogram samples
+func writeHistogram(out io.Writer, name string, labels string, h *histogram) {
+	var cumulative uint64
+
+	for i, bound := range h.bounds {
+		cumulative += h.counts[i]
+		fmt.Fprintf(
+			out,
+			"%s%s_bucket{%s,le=\"%s\"} %d\n",
+			metricsPrefix,
+			name,
+			labels,
+			strconv.FormatFloat(bound, 'g', -1, 64),
+			cumulative,
+		)
+	}
+
+	fmt.Fprintf(out, "%s%s_bucket{%s,le=\"+Inf\"} %d\n", metricsPrefix, name, labels, h.count)
+	fmt.Fprintf(out, "%s%s_sum{%s} %s\n", metricsPrefix, name, labels, strconv.FormatFloat(h.sum, 'g', -1, 64))
+	fmt.Fprintf(out, "%s%s_count{%s} %d\n", metricsPrefix, name, labels, h.count)
+}
+
+// escapeLabel escapes label value
+func escapeLabel(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+// countingWriter counts bytes written
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+
+	return n, err
+}
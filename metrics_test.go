@@ -0,0 +1,74 @@
+package traefik_change_response_test
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	changeresponse "github.com/bravepickle/traefik-change-response"
+)
+
+func TestMetrics(t *testing.T) {
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/fail" {
+			rw.WriteHeader(http.StatusInternalServerError)
+		}
+
+		_, _ = rw.Write([]byte("backend response"))
+	})
+
+	config := &changeresponse.Config{
+		Overrides: []changeresponse.Override{
+			{Name: "hide errors", From: []int{500}, To: 200, Body: "ok"},
+			{From: []int{500}, To: 503, Mode: changeresponse.ModeKeep},
+		},
+		MetricsPath: "/metrics",
+	}
+
+	handler, err := changeresponse.New(context.Background(), next, config, "test-plugin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{"/fail", "/fail", "/"} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "http://localhost"+path, nil))
+	}
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "http://localhost/metrics", nil))
+
+	if recorder.Code != http.StatusOK {
+		t.Errorf("Status code mismatch: got %d, want %d", recorder.Code, http.StatusOK)
+	}
+
+	expected := []string{
+		"# TYPE changeresponse_requests_total counter",
+		`changeresponse_requests_total{plugin="test-plugin"} 3`,
+		`changeresponse_rule_matches_total{plugin="test-plugin",rule="0",name="hide errors"} 2`,
+		`changeresponse_rule_matches_total{plugin="test-plugin",rule="1",name=""} 2`,
+		`changeresponse_status_transitions_total{plugin="test-plugin",from="500",to="503"} 2`,
+		`changeresponse_body_bytes_bucket{plugin="test-plugin",stage="before",le="256"} 3`,
+		`changeresponse_body_bytes_sum{plugin="test-plugin",stage="before"} 48`,
+		`changeresponse_body_bytes_sum{plugin="test-plugin",stage="after"} 20`,
+		`changeresponse_processing_seconds_count{plugin="test-plugin"} 3`,
+	}
+
+	for _, e := range expected {
+		if !strings.Contains(recorder.Body.String(), e) {
+			t.Errorf("Metrics mismatch\nactual:   %s\nexpected: %s", recorder.Body.String(), e)
+		}
+	}
+
+	// metrics are also accessible without the metrics path
+	buf := bytes.NewBuffer([]byte{})
+	if _, err := handler.(*changeresponse.Plugin).Metrics().WriteTo(buf); err != nil {
+		t.Fatal(err)
+	}
+
+	if buf.String() != recorder.Body.String() {
+		t.Errorf("Metrics mismatch\nactual:   %s\nexpected: %s", buf.String(), recorder.Body.String())
+	}
+}
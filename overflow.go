@@ -0,0 +1,181 @@
+package traefik_change_response
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Buffer overflow policies
+const (
+	OverflowPassthrough = "passthrough"
+	OverflowSpill       = "spill"
+	OverflowFail        = "fail"
+)
+
+const defaultOverflowStatus = http.StatusBadGateway
+
+var errBufferOverflow = errors.New("response body exceeds buffer limit")
+
+// spilledBody is a response body spilled to a temporary file
+type spilledBody struct {
+	file *os.File
+	size int64
+}
+
+// write appends data to the spilled body
+func (b *spilledBody) write(data []byte) (int, error) {
+	n, err := b.file.WriteAt(data, b.size)
+	b.size += int64(n)
+
+	return n, err
+}
+
+// remove deletes the temporary file
+func (b *spilledBody) remove() {
+	b.file.Close()
+	os.Remove(b.file.Name())
+}
+
+// validateOverflow validates rule buffer overflow policy and sets defaults
+func validateOverflow(o *Override) error {
+	switch o.OnOverflow {
+	case "", OverflowPassthrough, OverflowSpill:
+	case OverflowFail:
+		if o.OverflowStatus == 0 {
+			o.OverflowStatus = defaultOverflowStatus
+		}
+
+		if o.OverflowStatus < 100 || o.OverflowStatus > 999 {
+			return fmt.Errorf("invalid overflow status code: %d", o.OverflowStatus)
+		}
+	default:
+		return fmt.Errorf("unsupported overflow policy: %s", o.OnOverflow)
+	}
+
+	return nil
+}
+
+// overflowPolicy returns policy of the first rule matching the status code that defines one. Dry run rules must not
+// change the response, so their policies are ignored
+func (set *ruleSet) overflowPolicy(status int, dryRun bool) (policy string, failStatus int) {
+	if dryRun {
+		return OverflowPassthrough, 0
+	}
+
+	for _, i := range set.match(status) {
+		if r := &set.rules[i]; r.OnOverflow != "" && !r.DryRun {
+			return r.OnOverflow, r.OverflowStatus
+		}
+	}
+
+	return OverflowPassthrough, 0
+}
+
+// startOverflow switches response writer to the overflow policy when buffered body exceeds the limit
+func (rw *ResponseWriterWrapper) startOverflow(data []byte) (int, error) {
+	policy, failStatus := rw.rules.overflowPolicy(rw.status, rw.plugin.config.DryRun)
+
+	if policy == OverflowSpill {
+		file, err := os.CreateTemp("", "changeresponse-*")
+		if err == nil {
+			rw.spill = &spilledBody{file: file}
+			rw.overflow = OverflowSpill
+
+			if _, err := rw.spill.write(rw.body.Bytes()); err != nil {
+				return 0, err
+			}
+
+			rw.body.Reset()
+
+			return rw.spill.write(data)
+		}
+
+		rw.plugin.log(LevelError, &LogRecord{Message: "cannot spill response body", Error: err.Error()})
+		policy, failStatus = OverflowFail, defaultOverflowStatus
+	}
+
+	if policy == OverflowFail {
+		rw.overflow = OverflowFail
+		rw.failStatus = failStatus
+		rw.passed = int64(rw.body.Len() + len(data))
+		rw.body.Reset()
+
+		return 0, errBufferOverflow
+	}
+
+	rw.overflow = OverflowPassthrough
+	a := rw.plugin
+
+	if a.securityHeaders != nil {
+		a.securityHeaders.apply(rw.Header())
+	}
+
+	if a.config.RequestID != nil && rw.requestID != "" {
+		rw.Header().Set(a.config.RequestID.Header, rw.requestID)
+	}
+
+	rw.ResponseWriter.WriteHeader(rw.status)
+
+	n, err := rw.ResponseWriter.Write(rw.body.Bytes())
+	if rw.passed = int64(n); err != nil {
+		return 0, err
+	}
+
+	rw.body.Reset()
+
+	return rw.Write(data)
+}
+
+// finishOverflow completes response which body exceeded buffer limit
+func (a *Plugin) finishOverflow(wrapper *ResponseWriterWrapper, req *http.Request) {
+	started := time.Now()
+	status := wrapper.status
+	size := int(wrapper.passed)
+	record := &LogRecord{
+		Message:   "response body exceeds buffer limit, passed through",
+		RequestID: a.requestID(req),
+		Status:    wrapper.status,
+		NewStatus: wrapper.status,
+	}
+
+	if wrapper.overflow == OverflowFail {
+		status = wrapper.failStatus
+		headers := wrapper.ResponseWriter.Header()
+
+		for k := range headers {
+			delete(headers, k)
+		}
+
+		if a.config.RequestID != nil && record.RequestID != "" {
+			headers.Set(a.config.RequestID.Header, record.RequestID)
+		}
+
+		headers.Set("Content-Length", strconv.Itoa(0))
+
+		if a.signer != nil {
+			a.signer.sign(&responseState{status: status, headers: headers, body: &bytes.Buffer{}})
+		}
+
+		wrapper.ResponseWriter.WriteHeader(status)
+
+		record.Message = "response body exceeds buffer limit, failed"
+		record.NewStatus = status
+		size = 0
+	}
+
+	if a.breakers != nil && wrapper.circuitState != "" {
+		a.breakers.record(wrapper.circuitKey, wrapper.circuitState, wrapper.status)
+		wrapper.circuitState = ""
+	}
+
+	a.metrics.observeResponse(wrapper.rules, nil, wrapper.status, status, int(wrapper.passed), size, time.Since(started))
+
+	record.Duration = time.Since(wrapper.started)
+	record.BodySize = size
+	a.log(LevelWarn, record)
+}
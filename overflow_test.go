@@ -0,0 +1,265 @@
+package traefik_change_response_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+
+	changeresponse "github.com/bravepickle/traefik-change-response"
+)
+
+const largeBodySize = 64 << 20
+
+// discardResponseWriter counts written body bytes without keeping them
+type discardResponseWriter struct {
+	header http.Header
+	status int
+	size   int64
+	tail   []byte // the last written bytes
+}
+
+func (rw *discardResponseWriter) Header() http.Header {
+	return rw.header
+}
+
+func (rw *discardResponseWriter) WriteHeader(statusCode int) {
+	rw.status = statusCode
+}
+
+func (rw *discardResponseWriter) Write(data []byte) (int, error) {
+	rw.size += int64(len(data))
+	rw.tail = append(rw.tail, data[max(0, len(data)-64):]...)
+	rw.tail = rw.tail[max(0, len(rw.tail)-64):]
+
+	return len(data), nil
+}
+
+// largeBodyHandler writes synthetic body in chunks
+func largeBodyHandler(status int, size int) http.Handler {
+	chunk := bytes.Repeat([]byte("x"), 32<<10)
+
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.WriteHeader(status)
+
+		for written := 0; written < size; written += len(chunk) {
+			if _, err := rw.Write(chunk); err != nil {
+				return
+			}
+		}
+	})
+}
+
+func TestMaxBufferBytes(t *testing.T) {
+	datasets := []struct {
+		name         string
+		override     changeresponse.Override
+		expectedCode int
+		expectedSize int64
+		expectedTail string
+	}{
+		{
+			name:         "passthrough",
+			override:     changeresponse.Override{From: []int{500}, To: 200, Body: "replaced"},
+			expectedCode: 500,
+			expectedSize: largeBodySize,
+			expectedTail: "xxxx",
+		},
+		{
+			name: "spill",
+			override: changeresponse.Override{
+				From:       []int{500},
+				To:         200,
+				Mode:       changeresponse.ModeAppend,
+				Body:       "<!-- appended -->",
+				OnOverflow: changeresponse.OverflowSpill,
+			},
+			expectedCode: 200,
+			expectedSize: largeBodySize + int64(len("<!-- appended -->")),
+			expectedTail: "xxxx<!-- appended -->",
+		},
+		{
+			name: "fail",
+			override: changeresponse.Override{
+				From:           []int{500},
+				To:             200,
+				OnOverflow:     changeresponse.OverflowFail,
+				OverflowStatus: http.StatusInsufficientStorage,
+			},
+			expectedCode: http.StatusInsufficientStorage,
+			expectedSize: 0,
+		},
+	}
+
+	for _, d := range datasets {
+		t.Run(d.name, func(t *testing.T) {
+			config := &changeresponse.Config{
+				Overrides:      []changeresponse.Override{d.override},
+				MaxBufferBytes: 1 << 20,
+				RequestID:      &changeresponse.RequestID{},
+			}
+
+			handler, err := changeresponse.New(context.Background(), largeBodyHandler(500, largeBodySize), config, "test-plugin")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rw := &discardResponseWriter{header: http.Header{}}
+			req := httptest.NewRequest(http.MethodGet, "http://localhost", nil)
+
+			var before, after runtime.MemStats
+			runtime.GC()
+			runtime.ReadMemStats(&before)
+
+			handler.ServeHTTP(rw, req)
+
+			runtime.ReadMemStats(&after)
+
+			if allocated := after.TotalAlloc - before.TotalAlloc; allocated > 16<<20 {
+				t.Errorf("Allocated %d bytes for %d bytes body with 1MB buffer limit", allocated, largeBodySize)
+			}
+
+			if rw.status != d.expectedCode {
+				t.Errorf("Status code mismatch: got %d, want %d", rw.status, d.expectedCode)
+			}
+
+			if rw.size != d.expectedSize {
+				t.Errorf("Body size mismatch: got %d, want %d", rw.size, d.expectedSize)
+			}
+
+			if !bytes.HasSuffix(rw.tail, []byte(d.expectedTail)) {
+				t.Errorf("Body tail mismatch\nactual:   %s\nexpected: %s", rw.tail, d.expectedTail)
+			}
+
+			if rw.header.Get("X-Request-Id") == "" {
+				t.Errorf("Request ID must be echoed in the response")
+			}
+
+			var metrics bytes.Buffer
+			if _, err := handler.(*changeresponse.Plugin).Metrics().WriteTo(&metrics); err != nil {
+				t.Fatal(err)
+			}
+
+			count := `changeresponse_processing_seconds_count{plugin="test-plugin"} 1`
+			if !strings.Contains(metrics.String(), count) {
+				t.Errorf("Overflowed response must be observed in metrics:\n%s", metrics.String())
+			}
+
+			if cl := rw.header.Get("Content-Length"); d.name != "passthrough" && cl != strconv.FormatInt(d.expectedSize, 10) {
+				t.Errorf("Content-Length mismatch: got %s, want %d", cl, d.expectedSize)
+			}
+		})
+	}
+}
+
+func TestMaxBufferBytesSmallBody(t *testing.T) {
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.WriteHeader(http.StatusInternalServerError)
+		_, _ = io.WriteString(rw, "Some error")
+	})
+
+	config := &changeresponse.Config{
+		Overrides:      []changeresponse.Override{{From: []int{500}, To: 200, Body: "Everything is fine"}},
+		MaxBufferBytes: 1 << 10,
+	}
+
+	handler, err := changeresponse.New(context.Background(), next, config, "test-plugin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "http://localhost", nil))
+
+	if recorder.Code != 200 || recorder.Body.String() != "Everything is fine" {
+		t.Errorf("Unexpected response: [%d] %s", recorder.Code, recorder.Body.String())
+	}
+
+	config.Overrides[0].OnOverflow = "truncate"
+	if _, err := changeresponse.New(context.Background(), next, config, "test-plugin"); err == nil {
+		t.Error("Expected configuration error for unsupported overflow policy")
+	}
+}
+
+func TestMaxBufferBytesDryRun(t *testing.T) {
+	datasets := []struct {
+		name   string
+		config changeresponse.Config
+	}{
+		{
+			name: "dry run rule",
+			config: changeresponse.Config{
+				Overrides: []changeresponse.Override{{From: []int{500}, To: 200, OnOverflow: changeresponse.OverflowFail, DryRun: true}},
+			},
+		},
+		{
+			name: "dry run plugin",
+			config: changeresponse.Config{
+				Overrides: []changeresponse.Override{{From: []int{500}, To: 200, OnOverflow: changeresponse.OverflowFail}},
+				DryRun:    true,
+			},
+		},
+	}
+
+	for _, d := range datasets {
+		t.Run(d.name, func(t *testing.T) {
+			d.config.MaxBufferBytes = 1 << 10
+
+			handler, err := changeresponse.New(context.Background(), largeBodyHandler(500, 1<<20), &d.config, "test-plugin")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rw := &discardResponseWriter{header: http.Header{}}
+			handler.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "http://localhost", nil))
+
+			// dry run policies do not change the response
+			if rw.status != http.StatusInternalServerError || rw.size != 1<<20 {
+				t.Errorf("Response must be passed through: [%d] %d bytes", rw.status, rw.size)
+			}
+		})
+	}
+}
+
+func TestMaxBufferBytesPanic(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("TMPDIR", dir)
+
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.WriteHeader(http.StatusInternalServerError)
+		_, _ = rw.Write(bytes.Repeat([]byte("x"), 4<<10))
+
+		panic(http.ErrAbortHandler)
+	})
+
+	config := &changeresponse.Config{
+		Overrides:      []changeresponse.Override{{From: []int{500}, To: 200, OnOverflow: changeresponse.OverflowSpill}},
+		MaxBufferBytes: 1 << 10,
+	}
+
+	handler, err := changeresponse.New(context.Background(), next, config, "test-plugin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("Expected backend panic")
+			}
+		}()
+
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "http://localhost", nil))
+	}()
+
+	// spilled body is removed even if the response is not processed
+	if files, _ := filepath.Glob(filepath.Join(dir, "changeresponse-*")); len(files) > 0 {
+		t.Errorf("Spilled body files left: %v", files)
+	}
+}
@@ -7,81 +7,411 @@ import (
 	"net/http"
 	"slices"
 	"strconv"
+	"strings"
+	"time"
 )
 
 const (
-	ModeReplace = "replace"
-	ModeKeep    = "keep"
-	ModeAppend  = "append"
-	ModePrepend = "prepend"
+	ModeReplace  = "replace"
+	ModeKeep     = "keep"
+	ModeAppend   = "append"
+	ModePrepend  = "prepend"
+	ModeInject   = "inject"
+	ModeXML      = "xml"
+	ModeEnvelope = "envelope"
+	ModeUnwrap   = "unwrap"
 )
 
+// responseState is a response modified by override rules
+type responseState struct {
+	status  int
+	headers http.Header
+	body    *bytes.Buffer // body contents or, if it is spilled, contents preceding the spilled part
+	spill   *spilledBody  // body spilled to disk, nil if body is kept in memory
+	tail    *bytes.Buffer // contents following the spilled part
+
+	bodyChanged bool   // body was modified by override rules
+	cache       *Cache // cache policy of the last applied rule defining it
+}
+
+// clone copies response state to be modified independently
+func (s *responseState) clone() *responseState {
+	c := &responseState{
+		status:      s.status,
+		headers:     s.headers.Clone(),
+		body:        bytes.NewBuffer(bytes.Clone(s.body.Bytes())),
+		spill:       s.spill,
+		bodyChanged: s.bodyChanged,
+		cache:       s.cache,
+	}
+
+	if s.tail != nil {
+		c.tail = bytes.NewBuffer(bytes.Clone(s.tail.Bytes()))
+	}
+
+	return c
+}
+
+// bodyLen returns body size
+func (s *responseState) bodyLen() int64 {
+	size := int64(s.body.Len())
+
+	if s.spill != nil {
+		size += s.spill.size + int64(s.tail.Len())
+	}
+
+	return size
+}
+
+// appendBody adds contents to the end of the body
+func (s *responseState) appendBody(contents string) {
+	if s.spill != nil {
+		s.tail.WriteString(contents)
+	} else {
+		s.body.WriteString(contents)
+	}
+}
+
+// prependBody adds contents to the beginning of the body in place
+func (s *responseState) prependBody(contents string) {
+	s.insertBody(0, contents)
+}
+
+// insertBody inserts contents at the position of buffered body in place
+func (s *responseState) insertBody(pos int, contents string) {
+	size := s.body.Len()
+	s.body.WriteString(contents) // grow buffer by contents length
+
+	buf := s.body.Bytes()
+	copy(buf[pos+len(contents):], buf[pos:size])
+	copy(buf[pos:], contents)
+}
+
+// replaceBody replaces body with contents
+func (s *responseState) replaceBody(contents string) {
+	s.body.Reset()
+	s.body.WriteString(contents)
+	s.spill = nil
+	s.tail = nil
+}
+
+// writeBody writes body contents
+func (s *responseState) writeBody(w io.Writer) (int64, error) {
+	var n int
+	var err error
+
+	if s.body.Len() > 0 { // bodyless responses reject even empty writes
+		if n, err = w.Write(s.body.Bytes()); err != nil {
+			return int64(n), err
+		}
+	}
+
+	if s.spill == nil {
+		return int64(n), nil
+	}
+
+	m, err := io.Copy(w, io.NewSectionReader(s.spill.file, 0, s.spill.size))
+	if m += int64(n); err != nil {
+		return m, err
+	}
+
+	n, err = w.Write(s.tail.Bytes())
+
+	return m + int64(n), err
+}
+
 // changeResponse overrides response if status code in config matches
-func changeResponse(wrapper *ResponseWriterWrapper, a *Plugin) {
+func changeResponse(wrapper *ResponseWriterWrapper, req *http.Request, a *Plugin) {
+	if wrapper.overflow == OverflowPassthrough || wrapper.overflow == OverflowFail {
+		a.finishOverflow(wrapper, req)
+
+		return
+	}
+
 	rw := wrapper.ResponseWriter
+	rules := wrapper.rules
+	started := time.Now()
+	sizeBefore := int(wrapper.bodySize())
 
 	// buffer current response values
-	statusCode := wrapper.status
-	headers := wrapper.ResponseWriter.Header()
-	body := wrapper.body
-	appliedOverride := false
+	state := &responseState{status: wrapper.status, headers: rw.Header(), body: wrapper.body}
+	if wrapper.spill != nil {
+		state.spill = wrapper.spill
+		state.tail = &bytes.Buffer{}
+	}
+	vars := newTemplateVars(a, req, wrapper.status)
+	requestID := vars.requestID
+	debug := wrapper.debug
+	var appliedBuf [8]int
+	appliedRules := appliedBuf[:0]
 
-	for _, o := range a.config.Overrides {
-		// chain match by source code
-		if slices.Contains(o.From, wrapper.status) {
-			appliedOverride = true
+	var original http.Header // upstream response headers to report changes in debug mode
+	if debug {
+		original = state.headers.Clone()
+	}
 
-			statusCode = o.To // can be rewritten multiple times
+	if a.securityHeaders != nil {
+		a.securityHeaders.apply(state.headers)
+	}
 
-			for _, h := range o.RemoveHeaders {
-				headers.Del(h) // remove previously set headers
-			}
+	var shadow *responseState // response as it would be with dry run rules applied
+	var dryRules []int
 
-			for k, hv := range o.Headers {
-				if _, ok := headers[k]; ok { // we have this header already
-					headers.Del(k) // remove previously set headers
-				}
+	// chain rules matching source code
+	for _, i := range rules.match(wrapper.status) {
+		r := &rules.rules[i]
 
-				for _, h := range hv {
-					headers.Add(k, h)
-				}
-			}
+		if r.xml != nil && !r.xml.matches(state) {
+			continue // body does not contain the element to match
+		}
 
-			// rewrite body
-			switch o.Mode {
-			case ModeKeep:
-				// do nothing
-			case ModeAppend:
-				body.WriteString(o.Body)
-			case ModePrepend:
-				tmpBody := body.Bytes()
-				body = bytes.NewBufferString(o.Body)
-				body.Write(tmpBody)
-			case ModeReplace, "": // replace is the default behavior
-				body.Reset()
-				body.WriteString(o.Body)
-			default:
-				panic("Unsupported override mode: " + o.Mode)
+		if a.config.DryRun || r.DryRun {
+			if shadow == nil {
+				shadow = state.clone()
 			}
+
+			applyOverride(r, shadow, vars)
+			dryRules = append(dryRules, i)
+
+			continue
+		}
+
+		appliedRules = append(appliedRules, i)
+
+		var before *auditState
+		if a.audit != nil {
+			before = &auditState{status: state.status, bodyHash: state.bodyHash()}
+		}
+
+		applyOverride(r, state, vars)
+
+		if a.audit != nil {
+			a.audit.record(a.name, requestID, req, i, r.Override, before, state)
+		}
+
+		if shadow != nil {
+			applyOverride(r, shadow, vars)
 		}
 	}
 
+	if len(appliedRules) > 0 {
+		state.applyCache(wrapper.status)
+
+		if etag := state.applyIntegrity(a.config.Integrity); etag != "" {
+			state.notModified(req, etag)
+		}
+	}
+
+	if shadow != nil {
+		shadow.applyCache(wrapper.status)
+		shadow.applyIntegrity(a.config.Integrity)
+		reportDryRun(a, requestID, wrapper.status, dryRules, state, shadow)
+	}
+
+	headers := state.headers
+	bodySize := int(state.bodyLen())
+
+	var info *debugInfo
+	if debug && len(appliedRules) > 0 {
+		info = &debugInfo{
+			Plugin:         a.name,
+			OriginalStatus: wrapper.status,
+			Status:         state.status,
+			OriginalLength: sizeBefore,
+			Length:         bodySize,
+		}
+
+		for _, i := range appliedRules {
+			r := &rules.rules[i]
+			info.Rules = append(info.Rules, debugRule{Index: i, Name: r.Name, To: r.To})
+		}
+
+		info.HeadersAdded, info.HeadersRemoved = diffHeaders(original, headers)
+	}
+
+	if a.config.RequestID != nil && requestID != "" {
+		headers.Set(a.config.RequestID.Header, requestID)
+	}
+
 	// Set modified content length
-	headers.Set("Content-Length", strconv.Itoa(body.Len()))
+	if state.status == http.StatusNotModified {
+		headers.Del("Content-Length") // describes the body that is not sent
+	} else {
+		headers.Set("Content-Length", strconv.FormatInt(state.bodyLen(), 10))
+	}
 
-	if appliedOverride && a.config.Debug {
+	if info != nil {
 		headers.Add("X-Applied-Plugin", a.name)
+		info.writeHeaders(headers)
+
+		if acceptsTrailers(req) {
+			headers.Add("Trailer", debugTrailer)
+			headers.Del("Content-Length") // trailers require chunked transfer encoding
+		}
+	}
+
+	if a.breakers != nil && wrapper.circuitState != "" {
+		circuit := a.breakers.record(wrapper.circuitKey, wrapper.circuitState, wrapper.status)
+		wrapper.circuitState = ""
+
+		if debug {
+			headers.Set("X-Circuit-Breaker", circuitDebugHeader(circuit, wrapper.circuitKey))
+		}
 	}
 
-	rw.WriteHeader(statusCode)
+	if a.signer != nil {
+		a.signer.sign(state)
+	}
+
+	rw.WriteHeader(state.status)
 
 	// Write modified response
-	if _, err := io.Copy(rw, body); err != nil {
-		Alert("cannot write response body: " + err.Error())
+	var logBody string
+	if a.logEnabled(LevelDebug) && state.spill == nil {
+		logBody = truncateLogBody(state.body.Bytes(), a.config.LogBodyLimit)
+	}
+
+	_, err := state.writeBody(rw)
+	a.metrics.observeResponse(
+		rules,
+		appliedRules,
+		wrapper.status,
+		state.status,
+		sizeBefore,
+		bodySize,
+		time.Since(started),
+	)
+
+	level, message := LevelDebug, "response processed"
+	if err != nil {
+		level, message = LevelError, "cannot write response body"
 		http.Error(rw, err.Error(), http.StatusInternalServerError)
+	} else if info != nil && acceptsTrailers(req) {
+		rw.Header().Set(debugTrailer, info.trailer())
+	}
+
+	if a.logEnabled(level) {
+		record := &LogRecord{
+			Message:   message,
+			RequestID: requestID,
+			Rules:     slices.Clone(appliedRules),
+			Status:    wrapper.status,
+			NewStatus: state.status,
+			Duration:  time.Since(wrapper.started),
+			BodySize:  bodySize,
+			Body:      logBody,
+		}
+
+		if err != nil {
+			record.Error = err.Error()
+		}
+
+		a.log(level, record)
+	}
+}
+
+// applyOverride modifies response according to the override rule
+func applyOverride(r *rule, s *responseState, vars *templateVars) {
+	s.status = r.To // can be rewritten multiple times
+
+	for _, h := range r.removeHeaders {
+		delete(s.headers, h) // remove previously set headers
 	}
 
-	if a.config.Debug {
-		Notify(fmt.Sprintf("writing body: [%d] %s", body.Len(), body.String()))
+	if r.security != nil {
+		r.security.apply(s.headers)
 	}
+
+	for _, h := range r.headers {
+		if !h.template {
+			s.headers[h.name] = h.values // shared with the rule, its capacity is capped so appends copy it
+			continue
+		}
+
+		values := make([]string, len(h.values))
+		for i, v := range h.values {
+			values[i] = renderTemplate(v, vars, nil)
+		}
+
+		s.headers[h.name] = values
+	}
+
+	for i := range r.headerOps {
+		r.headerOps[i].apply(s.headers, vars)
+	}
+
+	if r.cookies != nil {
+		r.cookies.apply(s.headers, vars)
+	}
+
+	if r.cors != nil {
+		r.cors.apply(s.headers, vars.req)
+	}
+
+	if r.Cache != nil {
+		s.cache = r.Cache
+	}
+
+	if r.Mode != ModeKeep && s.rewriteBody(r, vars) {
+		s.bodyChanged = true
+	}
+
+	if r.Convert != nil && s.convertBody(r.Convert) {
+		s.bodyChanged = true
+	}
+}
+
+// rewriteBody modifies body according to the rule mode. Returns false if the body was left as it is
+func (s *responseState) rewriteBody(r *rule, vars *templateVars) bool {
+	body := r.Body
+	if r.bodyTemplate {
+		body = renderTemplate(body, vars, bodyEscaper(r.Mode, s))
+	}
+
+	switch r.Mode {
+	case ModeInject:
+		return s.injectBody(r.anchor, body)
+	case ModeXML:
+		return s.transformXML(r.xml, vars)
+	case ModeEnvelope:
+		return s.wrapBody(r.envelope, vars)
+	case ModeUnwrap:
+		return s.unwrapBody(r.envelope)
+	case ModeAppend:
+		s.appendBody(body)
+	case ModePrepend:
+		s.prependBody(body)
+	case ModeReplace, "": // replace is the default behavior
+		s.replaceBody(body)
+	default:
+		panic("Unsupported override mode: " + r.Mode)
+	}
+
+	return true
+}
+
+// reportDryRun notifies about changes dry run rules would make to the response
+func reportDryRun(a *Plugin, requestID string, status int, rules []int, actual *responseState, shadow *responseState) {
+	changed, removed := diffHeaders(actual.headers, shadow.headers)
+
+	indexes := make([]string, len(rules))
+	for i, rule := range rules {
+		indexes[i] = strconv.Itoa(rule)
+	}
+
+	summary := fmt.Sprintf("rule=%s to=%d size=%d", strings.Join(indexes, ","), shadow.status, shadow.bodyLen())
+	actual.headers.Add("X-Change-Response-Would-Apply", summary)
+
+	a.log(LevelInfo, &LogRecord{
+		Message:   "dry run",
+		RequestID: requestID,
+		Rules:     rules,
+		Status:    status,
+		NewStatus: shadow.status,
+		BodySize:  int(shadow.bodyLen()),
+		Fields: map[string]string{
+			"changedHeaders": strings.Join(changed, ","),
+			"removedHeaders": strings.Join(removed, ","),
+		},
+	})
 }
@@ -0,0 +1,154 @@
+package traefik_change_response
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Request ID formats
+const (
+	RequestIDFormatUUID = "uuid"
+	RequestIDFormatULID = "ulid"
+)
+
+const (
+	defaultRequestIDHeader = "X-Request-Id"
+	maxRequestIDLength     = 128
+)
+
+const crockfordAlphabet = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// RequestID propagates request correlation ID, generating a new one when it is missing
+type RequestID struct {
+	// Header name of request header to read ID from. Response echoes ID in the same header. Optional,
+	// default X-Request-Id
+	Header string `json:"header,omitempty"`
+
+	// Format of generated IDs. Optional
+	// Allowed:
+	//   uuid (default) - random UUID version 4
+	//   ulid - lexicographically sortable ULID
+	Format string `json:"format,omitempty"`
+}
+
+// validateRequestID validates request ID configuration and sets defaults
+func validateRequestID(config *RequestID) error {
+	if config.Header == "" {
+		config.Header = defaultRequestIDHeader
+	}
+
+	switch config.Format {
+	case RequestIDFormatUUID, RequestIDFormatULID:
+	case "":
+		config.Format = RequestIDFormatUUID
+	default:
+		return fmt.Errorf("unsupported request ID format: %s", config.Format)
+	}
+
+	return nil
+}
+
+// requestIDHeader returns name of the request ID header
+func (a *Plugin) requestIDHeader() string {
+	if a.config.RequestID != nil {
+		return a.config.RequestID.Header
+	}
+
+	return defaultRequestIDHeader
+}
+
+// requestID returns request correlation ID or empty string if it is missing or invalid
+func (a *Plugin) requestID(req *http.Request) string {
+	if id := req.Header.Get(a.requestIDHeader()); validRequestID(id) {
+		return id
+	}
+
+	return ""
+}
+
+// validRequestID checks that request ID consists of 1-128 letters, digits, dots, underscores or dashes, so that
+// client supplied IDs are safe to echo in responses and logs
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+
+	for _, c := range []byte(id) {
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9', c == '.', c == '_', c == '-':
+		default:
+			return false
+		}
+	}
+
+	return true
+}
+
+// ensureRequestID generates request ID if it is missing or invalid and injects it into the request
+func (a *Plugin) ensureRequestID(req *http.Request) {
+	header := a.config.RequestID.Header
+	if validRequestID(req.Header.Get(header)) {
+		return
+	}
+
+	if a.config.RequestID.Format == RequestIDFormatULID {
+		req.Header.Set(header, newULID())
+	} else {
+		req.Header.Set(header, newUUID())
+	}
+}
+
+// newUUID generates random UUID version 4
+func newUUID() string {
+	var id [16]byte
+	_, _ = rand.Read(id[:])
+
+	id[6] = (id[6] & 0x0f) | 0x40 // version 4
+	id[8] = (id[8] & 0x3f) | 0x80 // RFC 4122 variant
+
+	buf := make([]byte, 36)
+	hex.Encode(buf[0:8], id[0:4])
+	buf[8] = '-'
+	hex.Encode(buf[9:13], id[4:6])
+	buf[13] = '-'
+	hex.Encode(buf[14:18], id[6:8])
+	buf[18] = '-'
+	hex.Encode(buf[19:23], id[8:10])
+	buf[23] = '-'
+	hex.Encode(buf[24:], id[10:])
+
+	return string(buf)
+}
+
+// newULID generates ULID from the current time and random bytes
+func newULID() string {
+	var id [16]byte
+
+	ms := uint64(time.Now().UnixMilli())
+	for i := 0; i < 6; i++ {
+		id[i] = byte(ms >> (40 - 8*i))
+	}
+
+	_, _ = rand.Read(id[6:])
+
+	// 128 bits are encoded in 26 characters of 5 bits, padded with 2 leading zero bits
+	out := make([]byte, 26)
+	for i := range out {
+		var v byte
+
+		for b := i*5 - 2; b < i*5+3; b++ {
+			v <<= 1
+
+			if b >= 0 && id[b/8]&(0x80>>(b%8)) != 0 {
+				v |= 1
+			}
+		}
+
+		out[i] = crockfordAlphabet[v]
+	}
+
+	return string(out)
+}
@@ -0,0 +1,96 @@
+package traefik_change_response_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	changeresponse "github.com/bravepickle/traefik-change-response"
+)
+
+func TestRequestID(t *testing.T) {
+	datasets := []struct {
+		name     string
+		config   changeresponse.RequestID
+		incoming string
+		pattern  *regexp.Regexp
+	}{
+		{
+			name:    "generate uuid",
+			pattern: regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`),
+		},
+		{
+			name:    "generate ulid",
+			config:  changeresponse.RequestID{Header: "X-Correlation-Id", Format: changeresponse.RequestIDFormatULID},
+			pattern: regexp.MustCompile(`^[0-7][0-9A-HJKMNP-TV-Z]{25}$`),
+		},
+		{
+			name:     "propagate",
+			incoming: "abc-123",
+			pattern:  regexp.MustCompile(`^abc-123$`),
+		},
+		{
+			name:     "replace invalid",
+			incoming: `"><script>alert(1)</script>`,
+			pattern:  regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`),
+		},
+	}
+
+	for _, d := range datasets {
+		t.Run(d.name, func(t *testing.T) {
+			header := d.config.Header
+			if header == "" {
+				header = "X-Request-Id"
+			}
+
+			var backendID string
+			next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+				backendID = req.Header.Get(header)
+				rw.WriteHeader(http.StatusBadGateway)
+			})
+
+			config := &changeresponse.Config{
+				Overrides: []changeresponse.Override{{
+					From:    []int{502},
+					To:      503,
+					Headers: http.Header{"X-Error-Ref": []string{"ref-{{requestId}}"}},
+					Body:    `{"error": "unavailable", "requestId": "{{requestId}}", "status": {{status}}}`,
+				}},
+				RequestID: &d.config,
+			}
+
+			handler, err := changeresponse.New(context.Background(), next, config, "test-plugin")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "http://localhost", nil)
+			if d.incoming != "" {
+				req.Header.Set(header, d.incoming)
+			}
+
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, req)
+
+			id := recorder.Header().Get(header)
+			if !d.pattern.MatchString(id) {
+				t.Errorf("Unexpected request ID %q", id)
+			}
+
+			if backendID != id {
+				t.Errorf("Backend request ID mismatch: got %q, want %q", backendID, id)
+			}
+
+			if recorder.Header().Get("X-Error-Ref") != "ref-"+id {
+				t.Errorf("Header template mismatch: got %q", recorder.Header().Get("X-Error-Ref"))
+			}
+
+			expectedBody := `{"error": "unavailable", "requestId": "` + id + `", "status": 502}`
+			if recorder.Body.String() != expectedBody {
+				t.Errorf("Body mismatch\nactual:   %s\nexpected: %s", recorder.Body.String(), expectedBody)
+			}
+		})
+	}
+}
@@ -3,20 +3,106 @@ package traefik_change_response
 import (
 	"bytes"
 	"net/http"
+	"sync"
+	"time"
 )
 
+// maxPooledBufferSize max capacity of body buffers to keep for reuse
+const maxPooledBufferSize = 64 << 10
+
+var wrapperPool = sync.Pool{
+	New: func() any {
+		return &ResponseWriterWrapper{body: &bytes.Buffer{}}
+	},
+}
+
 // ResponseWriterWrapper captures the response body
 type ResponseWriterWrapper struct {
 	http.ResponseWriter
-	body   *bytes.Buffer
-	status int
+	body    *bytes.Buffer
+	status  int
+	started time.Time // request processing start time
+	plugin  *Plugin
+	rules   *ruleSet // override rules in effect for the request
+	debug   bool     // debug headers are enabled for the request
+
+	requestID string // request correlation ID echoed when the body is passed through on buffer overflow
+
+	overflow   string       // buffer overflow policy in effect, empty while body fits the buffer
+	failStatus int          // status code to respond with for the fail overflow policy
+	spill      *spilledBody // body spilled to disk for the spill overflow policy
+	passed     int64        // body size passed through or discarded for the passthrough and fail overflow policies
+
+	circuitKey   string // circuit breaker state key
+	circuitState string // circuit breaker state the request was admitted in
+}
+
+// newResponseWriterWrapper takes response writer wrapper from the pool
+func newResponseWriterWrapper(rw http.ResponseWriter, plugin *Plugin) *ResponseWriterWrapper {
+	wrapper := wrapperPool.Get().(*ResponseWriterWrapper)
+	wrapper.ResponseWriter = rw
+	wrapper.status = http.StatusOK
+	wrapper.started = time.Now()
+	wrapper.plugin = plugin
+	wrapper.rules = plugin.currentRules()
+
+	return wrapper
+}
+
+// free releases captured body, resets response writer wrapper and returns it to the pool. Called even if the backend
+// handler panics
+func (rw *ResponseWriterWrapper) free() {
+	rw.release()
+
+	body := rw.body
+	if body.Cap() > maxPooledBufferSize {
+		body = &bytes.Buffer{}
+	}
+
+	body.Reset()
+	*rw = ResponseWriterWrapper{body: body}
+	wrapperPool.Put(rw)
 }
 
 // WriteHeader Override WriteHeader to capture status code
 func (rw *ResponseWriterWrapper) WriteHeader(statusCode int) {
-	rw.status = statusCode
+	if rw.overflow == "" {
+		rw.status = statusCode
+	}
 }
 
 func (rw *ResponseWriterWrapper) Write(data []byte) (int, error) {
+	switch rw.overflow {
+	case OverflowPassthrough:
+		n, err := rw.ResponseWriter.Write(data)
+		rw.passed += int64(n)
+
+		return n, err
+	case OverflowSpill:
+		return rw.spill.write(data)
+	case OverflowFail:
+		return 0, errBufferOverflow
+	}
+
+	if limit := rw.plugin.config.MaxBufferBytes; limit > 0 && int64(rw.body.Len()+len(data)) > limit {
+		return rw.startOverflow(data)
+	}
+
 	return rw.body.Write(data)
 }
+
+// bodySize returns size of the captured body
+func (rw *ResponseWriterWrapper) bodySize() int64 {
+	if rw.spill != nil {
+		return rw.spill.size
+	}
+
+	return int64(rw.body.Len())
+}
+
+// release frees resources held by the captured body
+func (rw *ResponseWriterWrapper) release() {
+	if rw.spill != nil {
+		rw.spill.remove()
+	}
+}
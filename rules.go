@@ -0,0 +1,185 @@
+package traefik_change_response
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// maxStatusCode is the largest status code accepted by net/http
+const maxStatusCode = 999
+
+// ruleSet is a compiled set of override rules. It is immutable once built and is shared by concurrent requests
+type ruleSet struct {
+	rules    []rule
+	byStatus [maxStatusCode + 1][]int // indexes of rules matching the status code in order of definition
+}
+
+// rule is an override rule prepared for processing responses
+type rule struct {
+	*Override
+	index         int
+	removeHeaders []string      // canonical names of headers to remove
+	headers       []headerValue // headers to set
+	headerOps     []headerOp    // header operations in order
+	cookies       *cookieRules
+	security      *securityHeaders
+	cors          *corsRules
+	xml           *xmlRules
+	envelope      *envelopeRules
+	anchor        string // lowercase anchor of inject mode
+	bodyTemplate  bool   // body contains template placeholders
+}
+
+// headerValue is a header with its values to set
+type headerValue struct {
+	name     string // canonical header name
+	values   []string
+	template bool // values contain template placeholders
+}
+
+// compileRules validates override rules, precomputes their operations and indexes them by status code. Plugin config
+// provides defaults for the rules
+func compileRules(overrides []Override, config *Config) (*ruleSet, error) {
+	set := &ruleSet{rules: make([]rule, len(overrides))}
+
+	var defaultCORS *corsRules
+	if config.CORS != nil {
+		var err error
+		if defaultCORS, err = compileCORS(config.CORS); err != nil {
+			return nil, fmt.Errorf("cors: %w", err)
+		}
+	}
+
+	for i := range overrides {
+		o := &overrides[i]
+
+		switch o.Mode {
+		case ModeReplace, ModeKeep, ModeAppend, ModePrepend, ModeInject, ModeXML, ModeEnvelope, ModeUnwrap, "":
+		default:
+			return nil, fmt.Errorf("override %d: unsupported override mode: %s", i, o.Mode)
+		}
+
+		if err := validateOverflow(o); err != nil {
+			return nil, fmt.Errorf("override %d: %w", i, err)
+		}
+
+		for _, code := range o.From {
+			if code < 0 || code > maxStatusCode {
+				return nil, fmt.Errorf("override %d: invalid status code: %d", i, code)
+			}
+
+			if !slices.Contains(set.byStatus[code], i) { // duplicate codes must not apply the rule twice
+				set.byStatus[code] = append(set.byStatus[code], i)
+			}
+		}
+
+		r := rule{Override: o, index: i, bodyTemplate: strings.Contains(o.Body, "{{")}
+
+		if o.Mode == ModeInject {
+			var err error
+			if r.anchor, err = validateAnchor(o.Anchor); err != nil {
+				return nil, fmt.Errorf("override %d: %w", i, err)
+			}
+		} else if o.Anchor != "" {
+			return nil, fmt.Errorf("override %d: anchor is supported only in inject mode", i)
+		}
+
+		if o.Mode == ModeXML {
+			if o.XML == nil {
+				return nil, fmt.Errorf("override %d: xml transformation is required in xml mode", i)
+			}
+
+			var err error
+			if r.xml, err = compileXML(o.XML); err != nil {
+				return nil, fmt.Errorf("override %d: xml: %w", i, err)
+			}
+		} else if o.XML != nil {
+			return nil, fmt.Errorf("override %d: xml transformation is supported only in xml mode", i)
+		}
+
+		if o.Mode == ModeEnvelope || o.Mode == ModeUnwrap {
+			if o.Envelope == nil {
+				o.Envelope = &Envelope{}
+			}
+
+			var err error
+			if r.envelope, err = compileEnvelope(o.Envelope, o.Mode); err != nil {
+				return nil, fmt.Errorf("override %d: envelope: %w", i, err)
+			}
+		} else if o.Envelope != nil {
+			return nil, fmt.Errorf("override %d: envelope is supported only in envelope and unwrap modes", i)
+		}
+
+		if o.Convert != nil {
+			if err := validateConvert(o.Convert); err != nil {
+				return nil, fmt.Errorf("override %d: convert: %w", i, err)
+			}
+		}
+
+		for _, h := range o.RemoveHeaders {
+			r.removeHeaders = append(r.removeHeaders, http.CanonicalHeaderKey(h))
+		}
+
+		for k, hv := range o.Headers {
+			h := headerValue{name: http.CanonicalHeaderKey(k), values: hv[:len(hv):len(hv)]}
+
+			for _, v := range hv {
+				h.template = h.template || strings.Contains(v, "{{")
+			}
+
+			r.headers = append(r.headers, h)
+		}
+
+		for j := range o.HeaderOps {
+			op, err := compileHeaderOp(&o.HeaderOps[j])
+			if err != nil {
+				return nil, fmt.Errorf("override %d: header operation %d: %w", i, j, err)
+			}
+
+			r.headerOps = append(r.headerOps, op)
+		}
+
+		if o.SecurityHeaders != nil {
+			var err error
+			if r.security, err = compileSecurityHeaders(o.SecurityHeaders); err != nil {
+				return nil, fmt.Errorf("override %d: securityHeaders: %w", i, err)
+			}
+		}
+
+		if o.Cookies != nil {
+			var err error
+			if r.cookies, err = compileCookies(o.Cookies); err != nil {
+				return nil, fmt.Errorf("override %d: cookies: %w", i, err)
+			}
+		}
+
+		if o.Cache != nil {
+			if err := validateCache(o.Cache); err != nil {
+				return nil, fmt.Errorf("override %d: cache: %w", i, err)
+			}
+		}
+
+		r.cors = defaultCORS
+		if o.CORS != nil {
+			var err error
+			if r.cors, err = compileCORS(o.CORS); err != nil {
+				return nil, fmt.Errorf("override %d: cors: %w", i, err)
+			}
+		}
+
+		set.rules[i] = r
+	}
+
+	return set, nil
+}
+
+// match returns indexes of rules applying to the response status code
+func (set *ruleSet) match(status int) []int {
+	if status < 0 || status > maxStatusCode {
+		return nil
+	}
+
+	return set.byStatus[status]
+}
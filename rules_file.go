@@ -0,0 +1,214 @@
+package traefik_change_response
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const defaultRulesPollInterval = 5 * time.Second
+
+// rulesFile is the contents of the rules file
+type rulesFile struct {
+	Overrides []json.RawMessage `json:"overrides"` // decoded strictly one by one
+}
+
+// rulesFileState identifies version of the rules file
+type rulesFileState struct {
+	modTime time.Time
+	size    int64
+	missing bool // file could not be read last time it was checked
+}
+
+// changed checks if file differs from the state
+func (s rulesFileState) changed(info os.FileInfo) bool {
+	return s.missing || !info.ModTime().Equal(s.modTime) || info.Size() != s.size
+}
+
+// rulesWatchers are rules file pollers keyed by plugin name. Traefik builds a new middleware instance for every router
+// using it and on every configuration change without canceling context of the previous ones, so instances with the
+// same configuration share a single poller and a new configuration stops the poller of the previous one
+var rulesWatchers = struct {
+	sync.Mutex
+	names map[string]*rulesWatcher
+}{names: make(map[string]*rulesWatcher)}
+
+// rulesWatcher is a rules file poller shared by plugin instances
+type rulesWatcher struct {
+	config string        // configuration of the plugin instances sharing the poller
+	rules  *atomic.Value // *ruleSet
+	ctx    context.Context
+	stop   context.CancelFunc
+	done   chan struct{} // closed when the poller exits
+}
+
+// loadRulesFile reads and compiles override rules from JSON or YAML file resolving ${VAR} references. YAML is
+// converted to JSON, so that both are decoded strictly the same way
+func loadRulesFile(path string, config *Config) (*ruleSet, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read rules file: %w", err)
+	}
+
+	if trimmed := bytes.TrimSpace(data); len(trimmed) == 0 || trimmed[0] != '{' {
+		if data, err = yamlToJSON(data); err != nil {
+			return nil, fmt.Errorf("cannot parse rules file %s: %w", path, err)
+		}
+	}
+
+	var file rulesFile
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+
+	if err := decoder.Decode(&file); err != nil {
+		return nil, fmt.Errorf("cannot parse rules file %s: %w", path, err)
+	}
+
+	if decoder.More() {
+		return nil, fmt.Errorf("cannot parse rules file %s: unexpected data after the rules", path)
+	}
+
+	overrides := make([]Override, len(file.Overrides))
+	for i, raw := range file.Overrides {
+		if err := unmarshalOverride(raw, &overrides[i]); err != nil {
+			return nil, fmt.Errorf("cannot parse rules file %s: override %d: %w", path, i, err)
+		}
+	}
+
+	if err := interpolateValue(reflect.ValueOf(overrides), "rules file "+path+": overrides", config.StrictEnv); err != nil {
+		return nil, err
+	}
+
+	if len(overrides) == 0 {
+		return nil, fmt.Errorf("rules file %s: at least one override rule is required", path)
+	}
+
+	rules, err := compileRules(overrides, config)
+	if err != nil {
+		return nil, fmt.Errorf("rules file %s: %w", path, err)
+	}
+
+	return rules, nil
+}
+
+// rulesPollInterval parses rules file poll interval
+func rulesPollInterval(pollInterval string) (time.Duration, error) {
+	if pollInterval == "" {
+		return defaultRulesPollInterval, nil
+	}
+
+	interval, err := time.ParseDuration(pollInterval)
+	if err != nil {
+		return 0, fmt.Errorf("invalid rules poll interval: %w", err)
+	}
+
+	if interval <= 0 {
+		return 0, fmt.Errorf("rules poll interval must be positive: %s", pollInterval)
+	}
+
+	return interval, nil
+}
+
+// readRules loads override rules from the file returning its state to watch changes from
+func (a *Plugin) readRules(path string) (rulesFileState, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return rulesFileState{}, fmt.Errorf("cannot read rules file: %w", err)
+	}
+
+	rules, err := loadRulesFile(path, a.config)
+	if err != nil {
+		return rulesFileState{}, err
+	}
+
+	a.rules.Store(rules)
+
+	return rulesFileState{modTime: info.ModTime(), size: info.Size()}, nil
+}
+
+// watchRules reloads override rules on file changes until context is done or a plugin instance with the same name
+// and another configuration starts watching. Must be called when the plugin is fully configured
+func (a *Plugin) watchRules(ctx context.Context, config string, interval time.Duration, state rulesFileState) {
+	rulesWatchers.Lock()
+	defer rulesWatchers.Unlock()
+
+	if w := rulesWatchers.names[a.name]; w != nil {
+		if w.config == config && w.ctx.Err() == nil {
+			w.rules.Store(a.rules.Load()) // rules just loaded by this instance are the latest
+			a.rules = w.rules
+
+			return
+		}
+
+		w.stop()
+		<-w.done // previous rules must not be reloaded after the new instance is returned
+	}
+
+	pollCtx, stop := context.WithCancel(ctx)
+	done := make(chan struct{})
+	rulesWatchers.names[a.name] = &rulesWatcher{config: config, rules: a.rules, ctx: pollCtx, stop: stop, done: done}
+
+	go func() {
+		defer close(done)
+
+		a.pollRules(pollCtx, a.config.RulesFile, interval, state)
+	}()
+}
+
+// pollRules checks rules file for changes. Rules failing validation are rejected keeping the current ones
+func (a *Plugin) pollRules(ctx context.Context, path string, interval time.Duration, state rulesFileState) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		info, err := os.Stat(path)
+		if err != nil {
+			if !state.missing {
+				a.log(LevelError, &LogRecord{
+					Message: "cannot read rules file, keeping current rules",
+					Error:   err.Error(),
+				})
+			}
+
+			state.missing = true
+
+			continue
+		}
+
+		if !state.changed(info) {
+			continue
+		}
+
+		state = rulesFileState{modTime: info.ModTime(), size: info.Size()}
+
+		rules, err := loadRulesFile(path, a.config)
+		if err != nil {
+			a.log(LevelError, &LogRecord{
+				Message: "cannot reload rules, keeping current rules",
+				Error:   err.Error(),
+			})
+
+			continue
+		}
+
+		a.rules.Store(rules)
+		a.log(LevelInfo, &LogRecord{
+			Message: "rules reloaded",
+			Fields:  map[string]string{"file": path, "rules": strconv.Itoa(len(rules.rules))},
+		})
+	}
+}
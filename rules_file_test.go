@@ -0,0 +1,434 @@
+package traefik_change_response_test
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	changeresponse "github.com/bravepickle/traefik-change-response"
+)
+
+func TestRulesFile(t *testing.T) {
+	datasets := []struct {
+		name         string
+		file         string
+		contents     string
+		expectedCode int
+		expectedBody string
+	}{
+		{
+			name: "yaml",
+			file: "rules.yaml",
+			contents: `# hide backend errors
+overrides:
+  - name: hide-errors
+    from: [500, 501]
+    to: 200
+    headers:
+      X-Overridden: ["Yes"]
+    body: |
+      Everything
+      is fine
+  - from:
+      - 500
+    to: 202 # chained rule
+    mode: append
+    body: "#done"
+`,
+			expectedCode: 202,
+			expectedBody: "Everything\nis fine\n#done",
+		},
+		{
+			name: "chained rules",
+			file: "rules.json",
+			contents: `{
+  "overrides": [
+    {"name": "hide-errors", "from": [500, 501], "to": 200, "headers": {"X-Overridden": ["Yes"]}, "body": "Everything\nis fine\n"},
+    {"from": [500], "to": 202, "mode": "append", "body": "#done"}
+  ]
+}
+`,
+			expectedCode: 202,
+			expectedBody: "Everything\nis fine\n#done",
+		},
+		{
+			name:         "json",
+			file:         "rules.json",
+			contents:     `{"overrides": [{"from": [500], "to": 200, "headers": {"X-Overridden": ["Yes"]}, "body": "Everything is fine"}]}`,
+			expectedCode: 200,
+			expectedBody: "Everything is fine",
+		},
+	}
+
+	for _, d := range datasets {
+		t.Run(d.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), d.file)
+			writeRulesFile(t, path, d.contents)
+
+			handler := newRulesFileHandler(t, context.Background(), path)
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "http://localhost", nil))
+
+			if recorder.Code != d.expectedCode {
+				t.Errorf("Status code mismatch: got %d, want %d", recorder.Code, d.expectedCode)
+			}
+
+			if recorder.Body.String() != d.expectedBody {
+				t.Errorf("Body mismatch\nactual:   %q\nexpected: %q", recorder.Body.String(), d.expectedBody)
+			}
+
+			if recorder.Header().Get("X-Overridden") != "Yes" {
+				t.Errorf("Header mismatch: got %q, want %q", recorder.Header().Get("X-Overridden"), "Yes")
+			}
+		})
+	}
+}
+
+func TestRulesFileReload(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	out, errOut := &lockedBuffer{}, &lockedBuffer{}
+	captureLogs(t, out, errOut)
+
+	path := filepath.Join(t.TempDir(), "rules.json")
+	writeRulesFile(t, path, `{"overrides": [{"from": [500], "to": 200, "body": "first"}]}`)
+
+	handler := newRulesFileHandler(t, ctx, path)
+
+	waitResponseBody(t, handler, "first")
+
+	// valid rules are swapped
+	writeRulesFile(t, path, `{"overrides": [{"from": [500], "to": 200, "body": "second"}]}`)
+	waitResponseBody(t, handler, "second")
+	waitLog(t, out, `"msg":"rules reloaded"`)
+
+	// invalid rules are rejected keeping the current ones
+	writeRulesFile(t, path, `{"overrides": [{"from": [500], "to": 200, "mode": "unknown"}]}`)
+	waitLog(t, errOut, `"msg":"cannot reload rules, keeping current rules"`)
+	waitLog(t, errOut, "override 0: unsupported override mode: unknown")
+	waitResponseBody(t, handler, "second")
+}
+
+func TestRulesFileConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.json")
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {})
+
+	datasets := []struct {
+		name     string
+		config   *changeresponse.Config
+		contents string
+		expected string
+	}{
+		{
+			name: "overrides defined",
+			config: &changeresponse.Config{
+				Overrides: []changeresponse.Override{{From: []int{500}, To: 200}},
+				RulesFile: path,
+			},
+			contents: `{"overrides": [{"from": [500], "to": 200}]}`,
+			expected: "overrides and rulesFile are mutually exclusive",
+		},
+		{
+			name:     "no rules",
+			config:   &changeresponse.Config{RulesFile: path},
+			contents: `{"overrides": []}`,
+			expected: "rules file " + path + ": at least one override rule is required",
+		},
+		{
+			name:     "invalid json",
+			config:   &changeresponse.Config{RulesFile: path},
+			contents: `{"overrides": [{"from": [500}]}`,
+			expected: "cannot parse rules file " + path + ": invalid character '}' after array element",
+		},
+		{
+			name:     "invalid yaml",
+			config:   &changeresponse.Config{RulesFile: path},
+			contents: "overrides:\n  - from: [500\n",
+			expected: "cannot parse rules file " + path + ": yaml: line 2: unterminated flow collection",
+		},
+		{
+			name:     "unknown field",
+			config:   &changeresponse.Config{RulesFile: path},
+			contents: `{"overrides": [{"from": [500], "to": 200, "bodyy": "typo"}]}`,
+			expected: "cannot parse rules file " + path + `: override 0: json: unknown field "bodyy"`,
+		},
+		{
+			name:     "invalid poll interval",
+			config:   &changeresponse.Config{RulesFile: path, RulesPollInterval: "0s"},
+			contents: `{"overrides": [{"from": [500], "to": 200}]}`,
+			expected: "rules poll interval must be positive: 0s",
+		},
+	}
+
+	for _, d := range datasets {
+		t.Run(d.name, func(t *testing.T) {
+			writeRulesFile(t, path, d.contents)
+
+			_, err := changeresponse.New(context.Background(), next, d.config, "test-plugin")
+			if err == nil || err.Error() != d.expected {
+				t.Errorf("Unexpected error\nactual:   %v\nexpected: %s", err, d.expected)
+			}
+		})
+	}
+}
+
+func TestRulesFileYAML(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.yaml")
+
+	datasets := []struct {
+		name     string
+		contents string
+		expected string // response body or, if the rules are invalid, error message
+	}{
+		{
+			name:     "flow mapping",
+			contents: "overrides:\n  - {from: [500], to: 200, body: 'it''s fine # not a comment'}\n",
+			expected: "it's fine # not a comment",
+		},
+		{
+			name:     "double-quoted escapes",
+			contents: "overrides:\n- from: [500]\n  to: 200\n  body: \"line\\n\\u00e9\"\n",
+			expected: "line\né",
+		},
+		{
+			name:     "literal block keeping trailing line breaks",
+			contents: "overrides:\n  - from: [500]\n    to: 200\n    body: |+\n      a\n        b\n\n",
+			expected: "a\n  b\n\n",
+		},
+		{
+			name:     "folded block stripping line break",
+			contents: "---\noverrides:\n  - from: [500]\n    to: 200\n    body: >-\n      one\n      two\n\n      three\n...\n",
+			expected: "one two\nthree",
+		},
+		{
+			name:     "numbers and booleans as strings",
+			contents: "overrides:\n  - from: ['500']\n    to: '200'\n    dryRun: false\n    body: 42\n",
+			expected: "42",
+		},
+		{
+			name:     "unknown field",
+			contents: "overrides:\n  - from: [500]\n    to: 200\n    bodyy: typo\n",
+			expected: "cannot parse rules file " + path + `: override 0: json: unknown field "bodyy"`,
+		},
+		{
+			name:     "unknown top level field",
+			contents: "rules:\n  - from: [500]\n",
+			expected: "cannot parse rules file " + path + `: json: unknown field "rules"`,
+		},
+		{
+			name:     "duplicate key",
+			contents: "overrides:\n  - from: [500]\n    to: 200\n    to: 202\n",
+			expected: "cannot parse rules file " + path + `: yaml: line 4: duplicate key "to"`,
+		},
+		{
+			name:     "duplicate flow key",
+			contents: "overrides:\n  - {from: [500], to: 200, to: 202}\n",
+			expected: "cannot parse rules file " + path + `: yaml: line 2: duplicate key "to"`,
+		},
+		{
+			name:     "alias",
+			contents: "overrides:\n  - from: [500]\n    to: *status\n",
+			expected: "cannot parse rules file " + path + ": yaml: line 3: anchors and aliases are not supported: *status",
+		},
+		{
+			name:     "tag",
+			contents: "overrides:\n  - from: [500]\n    to: !!int 200\n",
+			expected: "cannot parse rules file " + path + ": yaml: line 3: tags are not supported: !!int 200",
+		},
+		{
+			name:     "multiple documents",
+			contents: "overrides:\n  - {from: [500], to: 200}\n---\noverrides: []\n",
+			expected: "cannot parse rules file " + path + ": yaml: line 3: multiple documents are not supported",
+		},
+	}
+
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.WriteHeader(http.StatusInternalServerError)
+	})
+
+	for _, d := range datasets {
+		t.Run(d.name, func(t *testing.T) {
+			writeRulesFile(t, path, d.contents)
+
+			handler, err := changeresponse.New(context.Background(), next, &changeresponse.Config{RulesFile: path}, "test-plugin")
+			if err != nil {
+				if err.Error() != d.expected {
+					t.Errorf("Unexpected error\nactual:   %v\nexpected: %s", err, d.expected)
+				}
+
+				return
+			}
+
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "http://localhost", nil))
+
+			if recorder.Body.String() != d.expected {
+				t.Errorf("Body mismatch\nactual:   %q\nexpected: %q", recorder.Body.String(), d.expected)
+			}
+		})
+	}
+}
+
+func TestRulesFileWatcher(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.json")
+	writeRulesFile(t, path, `{"overrides": [{"from": [500], "to": 200, "body": "first"}]}`)
+
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.WriteHeader(http.StatusInternalServerError)
+	})
+
+	newHandler := func(config *changeresponse.Config) (http.Handler, error) {
+		return changeresponse.New(context.Background(), next, config, "watcher-plugin")
+	}
+
+	previous, err := newHandler(&changeresponse.Config{RulesFile: path, RulesPollInterval: "5ms"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// failed configuration starts no poller
+	goroutines := runtime.NumGoroutine()
+
+	invalid := &changeresponse.Config{
+		RulesFile:         path,
+		RulesPollInterval: "5ms",
+		RequestID:         &changeresponse.RequestID{Format: "serial"},
+	}
+
+	if _, err := newHandler(invalid); err == nil {
+		t.Fatal("Expected configuration error")
+	}
+
+	if n := runtime.NumGoroutine(); n > goroutines {
+		t.Errorf("Failed configuration left %d goroutines running", n-goroutines)
+	}
+
+	// instance with the same configuration, e.g. for another router, shares the poller
+	shared, err := newHandler(&changeresponse.Config{RulesFile: path, RulesPollInterval: "5ms"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writeRulesFile(t, path, `{"overrides": [{"from": [500], "to": 200, "body": "second"}]}`)
+	waitResponseBody(t, previous, "second")
+	waitResponseBody(t, shared, "second")
+
+	// rebuilt instance with another configuration stops the previous poller
+	current, err := newHandler(&changeresponse.Config{RulesFile: path, RulesPollInterval: "4ms"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writeRulesFile(t, path, `{"overrides": [{"from": [500], "to": 200, "body": "third"}]}`)
+	waitResponseBody(t, current, "third")
+
+	time.Sleep(20 * time.Millisecond)
+	waitResponseBody(t, previous, "second")
+}
+
+// newRulesFileHandler creates plugin loading rules from the file with backend responding with 500 status code
+func newRulesFileHandler(t *testing.T, ctx context.Context, path string) http.Handler {
+	t.Helper()
+
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.WriteHeader(http.StatusInternalServerError)
+		_, _ = rw.Write([]byte("Some error"))
+	})
+
+	config := &changeresponse.Config{RulesFile: path, RulesPollInterval: "5ms"}
+
+	handler, err := changeresponse.New(ctx, next, config, "test-plugin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return handler
+}
+
+// writeRulesFile replaces rules file atomically making sure its modification time changes
+func writeRulesFile(t *testing.T, path string, contents string) {
+	t.Helper()
+
+	modTime := time.Now()
+	if info, err := os.Stat(path); err == nil {
+		modTime = info.ModTime().Add(time.Second)
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(contents), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Chtimes(tmp, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Rename(tmp, path); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func waitResponseBody(t *testing.T, handler http.Handler, expected string) {
+	t.Helper()
+
+	var body string
+	deadline := time.Now().Add(time.Second)
+
+	for time.Now().Before(deadline) {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "http://localhost", nil))
+
+		if body = recorder.Body.String(); body == expected {
+			return
+		}
+
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	t.Fatalf("Body mismatch\nactual:   %s\nexpected: %s", body, expected)
+}
+
+func waitLog(t *testing.T, out *lockedBuffer, expected string) {
+	t.Helper()
+
+	deadline := time.Now().Add(time.Second)
+
+	for time.Now().Before(deadline) {
+		if strings.Contains(out.String(), expected) {
+			return
+		}
+
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	t.Fatalf("Expected log record %s, got: %s", expected, out.String())
+}
+
+// lockedBuffer is a buffer safe for concurrent use
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.buf.String()
+}
@@ -0,0 +1,99 @@
+package traefik_change_response
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+)
+
+// Security headers presets
+const (
+	SecurityPresetBasic  = "basic"
+	SecurityPresetStrict = "strict"
+)
+
+var securityPresets = map[string]map[string]string{
+	SecurityPresetBasic: {
+		"Strict-Transport-Security": "max-age=31536000",
+		"X-Content-Type-Options":    "nosniff",
+		"X-Frame-Options":           "SAMEORIGIN",
+		"Referrer-Policy":           "strict-origin-when-cross-origin",
+	},
+	SecurityPresetStrict: {
+		"Strict-Transport-Security":  "max-age=63072000; includeSubDomains; preload",
+		"Content-Security-Policy":    "default-src 'self'; object-src 'none'; frame-ancestors 'none'; base-uri 'self'",
+		"X-Content-Type-Options":     "nosniff",
+		"X-Frame-Options":            "DENY",
+		"Referrer-Policy":            "no-referrer",
+		"Permissions-Policy":         "camera=(), microphone=(), geolocation=(), payment=()",
+		"Cross-Origin-Opener-Policy": "same-origin",
+	},
+}
+
+// SecurityHeaders sets a preset of security headers
+type SecurityHeaders struct {
+	// Preset name: basic or strict. Optional
+	Preset string `json:"preset,omitempty"`
+
+	// Headers overrides preset header values. Empty value excludes the header from the preset. Optional
+	Headers map[string]string `json:"headers,omitempty"`
+
+	// OnlyIfMissing sets headers only if the response does not have them already. Optional
+	OnlyIfMissing bool `json:"onlyIfMissing,omitempty"`
+}
+
+// securityHeaders are security headers prepared for processing responses
+type securityHeaders struct {
+	headers       []headerValue
+	onlyIfMissing bool
+}
+
+// compileSecurityHeaders resolves security headers preset and its overrides
+func compileSecurityHeaders(config *SecurityHeaders) (*securityHeaders, error) {
+	values := map[string]string{}
+
+	if config.Preset != "" {
+		preset, ok := securityPresets[config.Preset]
+		if !ok {
+			return nil, fmt.Errorf("unsupported security headers preset: %s", config.Preset)
+		}
+
+		for name, value := range preset {
+			values[name] = value
+		}
+	}
+
+	for name, value := range config.Headers {
+		name = http.CanonicalHeaderKey(name)
+
+		if value == "" {
+			delete(values, name)
+		} else {
+			values[name] = value
+		}
+	}
+
+	if len(values) == 0 {
+		return nil, fmt.Errorf("security headers preset or headers are required")
+	}
+
+	h := &securityHeaders{onlyIfMissing: config.OnlyIfMissing}
+	for name, value := range values {
+		h.headers = append(h.headers, headerValue{name: name, values: []string{value}})
+	}
+
+	sort.Slice(h.headers, func(i, j int) bool { return h.headers[i].name < h.headers[j].name })
+
+	return h, nil
+}
+
+// apply sets security headers
+func (h *securityHeaders) apply(headers http.Header) {
+	for _, v := range h.headers {
+		if h.onlyIfMissing && len(headers[v.name]) > 0 {
+			continue
+		}
+
+		headers[v.name] = v.values // shared, capacity equals length so appends copy it
+	}
+}
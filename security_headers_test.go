@@ -0,0 +1,119 @@
+package traefik_change_response_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	changeresponse "github.com/bravepickle/traefik-change-response"
+)
+
+func TestSecurityHeaders(t *testing.T) {
+	datasets := []struct {
+		name     string
+		config   string
+		headers  http.Header
+		expected map[string]string
+	}{
+		{
+			name:   "plugin preset",
+			config: `{"overrides": [{"from": [404], "to": 200}], "securityHeaders": {"preset": "strict", "onlyIfMissing": true}}`,
+			headers: http.Header{
+				"Content-Security-Policy": []string{"default-src 'self' cdn.example.com"},
+			},
+			expected: map[string]string{
+				"Strict-Transport-Security":  "max-age=63072000; includeSubDomains; preload",
+				"Content-Security-Policy":    "default-src 'self' cdn.example.com",
+				"X-Content-Type-Options":     "nosniff",
+				"X-Frame-Options":            "DENY",
+				"Referrer-Policy":            "no-referrer",
+				"Permissions-Policy":         "camera=(), microphone=(), geolocation=(), payment=()",
+				"Cross-Origin-Opener-Policy": "same-origin",
+			},
+		},
+		{
+			name:   "rule preset",
+			config: `{"overrides": [{"from": [500], "to": 200, "securityHeaders": {"preset": "basic"}}]}`,
+			headers: http.Header{
+				"X-Frame-Options": []string{"ALLOW-FROM https://example.com"},
+			},
+			expected: map[string]string{
+				"Strict-Transport-Security": "max-age=31536000",
+				"X-Content-Type-Options":    "nosniff",
+				"X-Frame-Options":           "SAMEORIGIN",
+				"Referrer-Policy":           "strict-origin-when-cross-origin",
+			},
+		},
+		{
+			name: "header overrides",
+			config: `{"overrides": [{"from": [500], "to": 200, "securityHeaders": {
+				"preset": "basic",
+				"headers": {"x-frame-options": "", "Referrer-Policy": "same-origin", "X-Permitted-Cross-Domain-Policies": "none"}
+			}}]}`,
+			expected: map[string]string{
+				"Strict-Transport-Security":         "max-age=31536000",
+				"X-Content-Type-Options":            "nosniff",
+				"X-Frame-Options":                   "",
+				"Referrer-Policy":                   "same-origin",
+				"X-Permitted-Cross-Domain-Policies": "none",
+			},
+		},
+	}
+
+	for _, d := range datasets {
+		t.Run(d.name, func(t *testing.T) {
+			input := inputDataset{responseCode: http.StatusInternalServerError, responseHeaders: d.headers}
+			if err := json.Unmarshal([]byte(d.config), &input.config); err != nil {
+				t.Fatal(err)
+			}
+
+			recorder := servePlugin(t, input)
+
+			for name, expected := range d.expected {
+				if actual := recorder.Header().Get(name); actual != expected {
+					t.Errorf("%s header mismatch: got %q, want %q", name, actual, expected)
+				}
+			}
+		})
+	}
+}
+
+func TestSecurityHeadersConfig(t *testing.T) {
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {})
+
+	datasets := []struct {
+		name     string
+		config   *changeresponse.Config
+		expected string
+	}{
+		{
+			name: "unsupported preset",
+			config: &changeresponse.Config{
+				Overrides:       []changeresponse.Override{{From: []int{500}, To: 200}},
+				SecurityHeaders: &changeresponse.SecurityHeaders{Preset: "paranoid"},
+			},
+			expected: "securityHeaders: unsupported security headers preset: paranoid",
+		},
+		{
+			name: "no headers",
+			config: &changeresponse.Config{
+				Overrides: []changeresponse.Override{{
+					From:            []int{500},
+					To:              200,
+					SecurityHeaders: &changeresponse.SecurityHeaders{OnlyIfMissing: true},
+				}},
+			},
+			expected: "override 0: securityHeaders: security headers preset or headers are required",
+		},
+	}
+
+	for _, d := range datasets {
+		t.Run(d.name, func(t *testing.T) {
+			_, err := changeresponse.New(context.Background(), next, d.config, "test-plugin")
+			if err == nil || err.Error() != d.expected {
+				t.Errorf("Unexpected error\nactual:   %v\nexpected: %s", err, d.expected)
+			}
+		})
+	}
+}
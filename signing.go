@@ -0,0 +1,152 @@
+package traefik_change_response
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"fmt"
+	"hash"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Signing algorithms
+const (
+	SigningHMACSHA256 = "hmac-sha256"
+	SigningHMACSHA512 = "hmac-sha512"
+)
+
+const defaultSignatureHeader = "X-Change-Response-Signature"
+
+// Signing signs responses with HMAC over status code, selected headers and body, so that clients can verify they
+// come from the edge
+type Signing struct {
+	// Keys list of active signing keys. Each key adds its own signature, so that clients may switch to a new key
+	// before the old one is removed. Required
+	Keys []SigningKey `json:"keys"`
+
+	// Headers names of response headers to sign in addition to status code and body. Optional
+	Headers []string `json:"headers,omitempty" list:"comma"`
+
+	// Header name of the response header to send signatures in. Optional, default X-Change-Response-Signature
+	Header string `json:"header,omitempty"`
+
+	// Algorithm of signatures: hmac-sha256 (default), hmac-sha512. Optional
+	Algorithm string `json:"algorithm,omitempty"`
+}
+
+// SigningKey is a secret key clients refer to by its ID
+type SigningKey struct {
+	// ID of the key sent along with the signature. Required
+	ID string `json:"id"`
+
+	// Secret of the key. Required
+	Secret string `json:"secret"`
+}
+
+// signer signs responses with configured keys
+type signer struct {
+	config  *Signing
+	hash    func() hash.Hash
+	headers []string // canonical names of signed headers
+	params  []string // signature parameters preceding the signature itself, per key
+}
+
+// newSigner validates signing configuration
+func newSigner(config *Signing) (*signer, error) {
+	if len(config.Keys) == 0 {
+		return nil, fmt.Errorf("at least one key is required")
+	}
+
+	if config.Header == "" {
+		config.Header = defaultSignatureHeader
+	}
+
+	config.Header = http.CanonicalHeaderKey(config.Header) // set directly in the header map
+
+	s := &signer{config: config}
+
+	switch config.Algorithm {
+	case "":
+		config.Algorithm = SigningHMACSHA256
+		s.hash = sha256.New
+	case SigningHMACSHA256:
+		s.hash = sha256.New
+	case SigningHMACSHA512:
+		s.hash = sha512.New
+	default:
+		return nil, fmt.Errorf("unsupported algorithm: %s", config.Algorithm)
+	}
+
+	names := make([]string, len(config.Headers))
+	for i, name := range config.Headers {
+		name = http.CanonicalHeaderKey(name)
+		if name == config.Header {
+			return nil, fmt.Errorf("signature header can not be signed: %s", name)
+		}
+
+		s.headers = append(s.headers, name)
+		names[i] = strings.ToLower(name)
+	}
+
+	for i, key := range config.Keys {
+		if key.ID == "" || key.Secret == "" {
+			return nil, fmt.Errorf("key %d: id and secret are required", i)
+		}
+
+		if strings.ContainsAny(key.ID, "\"\\, ") {
+			return nil, fmt.Errorf("key %d: id must not contain quotes, backslashes, commas or spaces: %s", i, key.ID)
+		}
+
+		s.params = append(s.params, fmt.Sprintf(`keyId="%s", alg="%s", headers="%s", signature=`,
+			key.ID, config.Algorithm, strings.Join(names, " ")))
+	}
+
+	return s, nil
+}
+
+// sign sets signatures of the response with every key
+func (s *signer) sign(state *responseState) {
+	base := s.signatureBase(state)
+
+	values := make([]string, len(s.config.Keys))
+	for i, key := range s.config.Keys {
+		mac := hmac.New(s.hash, []byte(key.Secret))
+		mac.Write(base)
+
+		values[i] = s.params[i] + `"` + base64.StdEncoding.EncodeToString(mac.Sum(nil)) + `"`
+	}
+
+	state.headers[s.config.Header] = values
+}
+
+// signatureBase builds canonical representation of the response. Every line is terminated with \n:
+//
+//	status: <status code>
+//	<lowercase header name>: <header values joined with ", "> - for every signed header in configured order
+//	body: sha-256=:<base64 sha-256 of the body>:
+func (s *signer) signatureBase(state *responseState) []byte {
+	var b strings.Builder
+
+	b.WriteString("status: ")
+	b.WriteString(strconv.Itoa(state.status))
+	b.WriteByte('\n')
+
+	for _, name := range s.headers {
+		b.WriteString(strings.ToLower(name))
+		b.WriteString(": ")
+		b.WriteString(strings.Join(state.headers.Values(name), ", "))
+		b.WriteByte('\n')
+	}
+
+	h := sha256.New()
+	_, _ = state.writeBody(h)
+
+	b.WriteString("body: sha-256=:")
+	b.WriteString(base64.StdEncoding.EncodeToString(h.Sum(nil)))
+	b.WriteString(":\n")
+
+	return []byte(b.String())
+}
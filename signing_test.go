@@ -0,0 +1,239 @@
+package traefik_change_response_test
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	changeresponse "github.com/bravepickle/traefik-change-response"
+)
+
+// Test vectors of signature format. Signature base of the first ones:
+//
+//	status: 503
+//	content-type: application/json
+//	x-request-id: 4bf92f3577b34da6
+//	body: sha-256=:NhrgD8jEPrI0Bp+aq1fZqQCX4DhdBrOwCzet7gNqPnk=:
+func TestSigning(t *testing.T) {
+	keys := []changeresponse.SigningKey{
+		{ID: "2026-01", Secret: "2026-01-secret"},
+		{ID: "2026-07", Secret: "2026-07-secret"},
+	}
+
+	upstream := http.Header{
+		"Content-Type": []string{"application/json"},
+		"X-Request-Id": []string{"4bf92f3577b34da6"},
+	}
+
+	datasets := []struct {
+		name         string
+		signing      changeresponse.Signing
+		responseCode int
+		expected     []string
+	}{
+		{
+			name:         "rotated keys",
+			signing:      changeresponse.Signing{Keys: keys, Headers: []string{"Content-Type", "x-request-id"}},
+			responseCode: http.StatusServiceUnavailable,
+			expected: []string{
+				`keyId="2026-01", alg="hmac-sha256", headers="content-type x-request-id", signature="Lh/V/19wtrhT+wJeUhizagn9U7Nvq5cHivpGKGLbfjg="`,
+				`keyId="2026-07", alg="hmac-sha256", headers="content-type x-request-id", signature="oA6q1gZGvcHWLXG4iDNBwCa66kd6s46Ssg98DT7VUVY="`,
+			},
+		},
+		{
+			name: "hmac-sha512",
+			signing: changeresponse.Signing{
+				Keys:      keys[:1],
+				Headers:   []string{"Content-Type", "X-Request-Id"},
+				Algorithm: changeresponse.SigningHMACSHA512,
+			},
+			responseCode: http.StatusServiceUnavailable,
+			expected: []string{
+				`keyId="2026-01", alg="hmac-sha512", headers="content-type x-request-id", ` +
+					`signature="pygWBd+5uRgjEyORGn5oD+Rsng0QuqrIyNYZJoIA4g63NGKrmQ8nRn7azypiVztWQnY+r4/cAhGK+qfx6IcPEA=="`,
+			},
+		},
+		{
+			// signature base:
+			//   status: 204
+			//   body: sha-256=:47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU=:
+			name:         "modified response without headers",
+			signing:      changeresponse.Signing{Keys: keys[:1]},
+			responseCode: http.StatusInternalServerError,
+			expected: []string{
+				`keyId="2026-01", alg="hmac-sha256", headers="", signature="WLYiZSH6MbOxJhzh2twGamyvjSGALeuC6zqkMFEqJNs="`,
+			},
+		},
+	}
+
+	for _, d := range datasets {
+		t.Run(d.name, func(t *testing.T) {
+			recorder := servePlugin(t, inputDataset{
+				config: changeresponse.Config{
+					Overrides: []changeresponse.Override{{From: []int{500}, To: 204}},
+					Signing:   &d.signing,
+				},
+				responseCode:    d.responseCode,
+				responseHeaders: upstream,
+				responseBody:    `{"error":"temporarily unavailable"}`,
+			})
+
+			assertHeadersEqual(t, "X-Change-Response-Signature", recorder.Header(),
+				http.Header{"X-Change-Response-Signature": d.expected})
+		})
+	}
+}
+
+func TestSigningHeader(t *testing.T) {
+	recorder := servePlugin(t, inputDataset{
+		config: changeresponse.Config{
+			Overrides: []changeresponse.Override{{From: []int{500}, To: 204}},
+			Signing: &changeresponse.Signing{
+				Keys:   []changeresponse.SigningKey{{ID: "2026-01", Secret: "2026-01-secret"}},
+				Header: "x-edge-signature",
+			},
+		},
+		responseCode: http.StatusInternalServerError,
+	})
+
+	if values := recorder.Header()["X-Edge-Signature"]; len(values) != 1 {
+		t.Errorf("Signature must be set in canonical header, got headers: %v", recorder.Header())
+	}
+}
+
+func TestSigningFastFailures(t *testing.T) {
+	key := changeresponse.SigningKey{ID: "2026-01", Secret: "2026-01-secret"}
+
+	datasets := []struct {
+		name           string
+		config         changeresponse.Config
+		next           http.Handler
+		requests       int // the last one is checked
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name: "circuit breaker",
+			config: changeresponse.Config{
+				Overrides:      []changeresponse.Override{{From: []int{404}, To: 200}},
+				CircuitBreaker: &changeresponse.CircuitBreaker{Threshold: 0.5, Window: 2, Cooldown: "1m", Body: "backend is down"},
+			},
+			next: http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+				rw.WriteHeader(http.StatusBadGateway)
+			}),
+			requests:       3,
+			expectedStatus: http.StatusServiceUnavailable,
+			expectedBody:   "backend is down",
+		},
+		{
+			name: "buffer overflow",
+			config: changeresponse.Config{
+				Overrides: []changeresponse.Override{{
+					From:           []int{500},
+					To:             200,
+					OnOverflow:     changeresponse.OverflowFail,
+					OverflowStatus: http.StatusInsufficientStorage,
+				}},
+				MaxBufferBytes: 1 << 10,
+			},
+			next:           largeBodyHandler(http.StatusInternalServerError, 1<<20),
+			requests:       1,
+			expectedStatus: http.StatusInsufficientStorage,
+		},
+	}
+
+	for _, d := range datasets {
+		t.Run(d.name, func(t *testing.T) {
+			d.config.Signing = &changeresponse.Signing{Keys: []changeresponse.SigningKey{key}}
+
+			handler, err := changeresponse.New(context.Background(), d.next, &d.config, "test-plugin")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var rw *discardResponseWriter
+			for i := 0; i < d.requests; i++ {
+				rw = &discardResponseWriter{header: http.Header{}}
+				handler.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "http://localhost", nil))
+			}
+
+			if rw.status != d.expectedStatus || string(rw.tail) != d.expectedBody {
+				t.Fatalf("Unexpected response: [%d] %s", rw.status, rw.tail)
+			}
+
+			bodyHash := sha256.Sum256([]byte(d.expectedBody))
+			base := "status: " + strconv.Itoa(d.expectedStatus) + "\n" +
+				"body: sha-256=:" + base64.StdEncoding.EncodeToString(bodyHash[:]) + ":\n"
+
+			mac := hmac.New(sha256.New, []byte(key.Secret))
+			mac.Write([]byte(base))
+
+			expected := `keyId="2026-01", alg="hmac-sha256", headers="", signature="` +
+				base64.StdEncoding.EncodeToString(mac.Sum(nil)) + `"`
+
+			assertHeadersEqual(t, "X-Change-Response-Signature", rw.header,
+				http.Header{"X-Change-Response-Signature": []string{expected}})
+		})
+	}
+}
+
+func TestSigningConfig(t *testing.T) {
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {})
+
+	datasets := []struct {
+		name     string
+		signing  changeresponse.Signing
+		expected string
+	}{
+		{
+			name:     "no keys",
+			expected: "signing: at least one key is required",
+		},
+		{
+			name:     "no secret",
+			signing:  changeresponse.Signing{Keys: []changeresponse.SigningKey{{ID: "k1"}}},
+			expected: "signing: key 0: id and secret are required",
+		},
+		{
+			name:     "invalid key id",
+			signing:  changeresponse.Signing{Keys: []changeresponse.SigningKey{{ID: `k"1`, Secret: "s3cret"}}},
+			expected: `signing: key 0: id must not contain quotes, backslashes, commas or spaces: k"1`,
+		},
+		{
+			name: "unsupported algorithm",
+			signing: changeresponse.Signing{
+				Keys:      []changeresponse.SigningKey{{ID: "k1", Secret: "s3cret"}},
+				Algorithm: "md5",
+			},
+			expected: "signing: unsupported algorithm: md5",
+		},
+		{
+			name: "signed signature header",
+			signing: changeresponse.Signing{
+				Keys:    []changeresponse.SigningKey{{ID: "k1", Secret: "s3cret"}},
+				Headers: []string{"Content-Type", "x-signature"},
+				Header:  "X-SIGNATURE",
+			},
+			expected: "signing: signature header can not be signed: X-Signature",
+		},
+	}
+
+	for _, d := range datasets {
+		t.Run(d.name, func(t *testing.T) {
+			config := &changeresponse.Config{
+				Overrides: []changeresponse.Override{{From: []int{500}, To: 200}},
+				Signing:   &d.signing,
+			}
+
+			_, err := changeresponse.New(context.Background(), next, config, "test-plugin")
+			if err == nil || err.Error() != d.expected {
+				t.Errorf("Unexpected error\nactual:   %v\nexpected: %s", err, d.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,121 @@
+package traefik_change_response
+
+import (
+	"bytes"
+	"html"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// templateVars are values available in body and header templates as {{name}} placeholders
+type templateVars struct {
+	requestID string
+	method    string
+	host      string
+	path      string
+	status    int       // original response status code
+	now       time.Time // time of processing the response
+
+	req *http.Request // request being processed
+}
+
+// newTemplateVars collects template values for the request
+func newTemplateVars(a *Plugin, req *http.Request, status int) *templateVars {
+	return &templateVars{
+		requestID: a.requestID(req),
+		method:    req.Method,
+		host:      req.Host,
+		path:      req.URL.Path,
+		status:    status,
+		now:       time.Now(),
+		req:       req,
+	}
+}
+
+// lookup returns value of the placeholder
+func (v *templateVars) lookup(name string) (string, bool) {
+	switch name {
+	case "requestId":
+		return v.requestID, true
+	case "method":
+		return v.method, true
+	case "host":
+		return v.host, true
+	case "path":
+		return v.path, true
+	case "status":
+		return strconv.Itoa(v.status), true
+	case "timestamp":
+		return v.now.UTC().Format(time.RFC3339), true
+	default:
+		return "", false
+	}
+}
+
+// renderTemplate replaces known {{name}} placeholders with their values escaped for the context, nil escape keeps values
+// as is. Unknown placeholders are kept as is
+func renderTemplate(tmpl string, vars *templateVars, escape func(string) string) string {
+	if vars == nil || !strings.Contains(tmpl, "{{") {
+		return tmpl
+	}
+
+	var out strings.Builder
+
+	for {
+		start := strings.Index(tmpl, "{{")
+		if start < 0 {
+			break
+		}
+
+		end := strings.Index(tmpl[start+2:], "}}")
+		if end < 0 {
+			break
+		}
+
+		end += start + 2
+		out.WriteString(tmpl[:start])
+
+		if value, ok := vars.lookup(strings.TrimSpace(tmpl[start+2 : end])); ok {
+			if escape != nil {
+				value = escape(value)
+			}
+
+			out.WriteString(value)
+		} else {
+			out.WriteString(tmpl[start : end+2])
+		}
+
+		tmpl = tmpl[end+2:]
+	}
+
+	out.WriteString(tmpl)
+
+	return out.String()
+}
+
+// bodyEscaper returns function escaping template values for the response body, so that request values cannot inject
+// markup or break JSON strings. Returns nil for other bodies
+func bodyEscaper(mode string, s *responseState) func(string) string {
+	if mode == ModeInject || isHTML(s.headers) {
+		return html.EscapeString
+	}
+
+	switch bodyFormat(s) {
+	case FormatXML:
+		return html.EscapeString // escapes the same characters as XML requires
+	case FormatJSON:
+		return escapeJSONString
+	}
+
+	return nil
+}
+
+// escapeJSONString escapes value to be placed inside JSON string
+func escapeJSONString(value string) string {
+	var b bytes.Buffer
+	writeJSON(&b, value)
+
+	return b.String()[1 : b.Len()-1] // without quotes
+}
@@ -0,0 +1,96 @@
+package traefik_change_response_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	changeresponse "github.com/bravepickle/traefik-change-response"
+)
+
+func TestTemplateEscaping(t *testing.T) {
+	path := `/"><script>alert(1)</script>`
+
+	datasets := []struct {
+		name     string
+		override changeresponse.Override
+		headers  http.Header
+		body     string
+		expected string
+	}{
+		{
+			name: "html body",
+			override: changeresponse.Override{
+				Headers: http.Header{"Content-Type": []string{"text/html"}},
+				Body:    `<a href="{{path}}">retry</a>`,
+			},
+			expected: `<a href="/&#34;&gt;&lt;script&gt;alert(1)&lt;/script&gt;">retry</a>`,
+		},
+		{
+			name: "xml body",
+			override: changeresponse.Override{
+				Headers: http.Header{"Content-Type": []string{"application/xml"}},
+				Body:    `<error path="{{path}}"/>`,
+			},
+			expected: `<error path="/&#34;&gt;&lt;script&gt;alert(1)&lt;/script&gt;"/>`,
+		},
+		{
+			name: "json body",
+			override: changeresponse.Override{
+				Headers: http.Header{"Content-Type": []string{"application/json"}},
+				Body:    `{"path": "{{path}}"}`,
+			},
+			expected: `{"path": "/\"><script>alert(1)</script>"}`,
+		},
+		{
+			name:     "inject mode",
+			override: changeresponse.Override{Mode: changeresponse.ModeInject, Body: `<p>{{path}}</p>`},
+			headers:  http.Header{"Content-Type": []string{"text/html"}},
+			body:     `<html><body></body></html>`,
+			expected: `<html><body><p>/&#34;&gt;&lt;script&gt;alert(1)&lt;/script&gt;</p></body></html>`,
+		},
+		{
+			name: "plain text body",
+			override: changeresponse.Override{
+				Headers: http.Header{"Content-Type": []string{"text/plain"}},
+				Body:    `path: {{path}}`,
+			},
+			expected: `path: ` + path,
+		},
+	}
+
+	for _, d := range datasets {
+		t.Run(d.name, func(t *testing.T) {
+			next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+				for k, v := range d.headers {
+					rw.Header()[k] = v
+				}
+
+				rw.WriteHeader(http.StatusNotFound)
+				_, _ = rw.Write([]byte(d.body))
+			})
+
+			override := d.override
+			override.From = []int{404}
+			override.To = 404
+
+			config := &changeresponse.Config{Overrides: []changeresponse.Override{override}}
+
+			handler, err := changeresponse.New(context.Background(), next, config, "test-plugin")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "http://localhost", nil)
+			req.URL.Path = path
+
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, req)
+
+			if recorder.Body.String() != d.expected {
+				t.Errorf("Body mismatch\nactual:   %s\nexpected: %s", recorder.Body.String(), d.expected)
+			}
+		})
+	}
+}
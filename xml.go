@@ -0,0 +1,507 @@
+package traefik_change_response
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// XML element operations
+const (
+	XMLOpSet    = "set"
+	XMLOpDelete = "delete"
+	XMLOpWrap   = "wrap"
+)
+
+// XMLTransform modifies XML bodies in xml mode. Elements are referred to by paths of their local names ignoring
+// namespace prefixes, e.g. /Envelope/Body/Fault or //faultstring at any depth. * step matches any element
+type XMLTransform struct {
+	// Match path of the element the body must contain for the rule to apply. Optional
+	Match string `json:"match,omitempty"`
+
+	// Ops list of element operations to apply in order. Optional
+	Ops []XMLOp `json:"ops,omitempty"`
+
+	// FaultToJSON converts SOAP fault into JSON error body. Optional
+	FaultToJSON bool `json:"faultToJson,omitempty"`
+}
+
+// XMLOp is a single operation on XML elements matching the path
+type XMLOp struct {
+	// Op operation to apply. Required
+	// Allowed:
+	//   set - set text contents or, if attr is defined, attribute value of elements
+	//   delete - remove elements
+	//   wrap - wrap elements into a new element
+	Op string `json:"op"`
+
+	// Path of elements to apply the operation to. Required
+	Path string `json:"path"`
+
+	// Value to set, supports {{name}} placeholders. Used by set
+	Value string `json:"value,omitempty"`
+
+	// Attr name of attribute to set. Used by set, optional
+	Attr string `json:"attr,omitempty"`
+
+	// Element name of the wrapping element. Required by wrap
+	Element string `json:"element,omitempty"`
+}
+
+// xmlPath is a compiled element path
+type xmlPath struct {
+	steps    []string // local names, * matches any element
+	anywhere bool     // path may start at any depth
+}
+
+// xmlRules is an XML transformation prepared for processing responses
+type xmlRules struct {
+	config *XMLTransform
+	match  *xmlPath
+	ops    []xmlOp
+}
+
+// xmlOp is an element operation prepared for processing responses
+type xmlOp struct {
+	*XMLOp
+	path     xmlPath
+	template bool // value contains template placeholders
+}
+
+// compileXML validates XML transformation
+func compileXML(config *XMLTransform) (*xmlRules, error) {
+	x := &xmlRules{config: config}
+
+	if config.Match != "" {
+		path, err := parseXMLPath(config.Match)
+		if err != nil {
+			return nil, fmt.Errorf("match: %w", err)
+		}
+
+		x.match = &path
+	}
+
+	for i := range config.Ops {
+		op := xmlOp{XMLOp: &config.Ops[i], template: strings.Contains(config.Ops[i].Value, "{{")}
+
+		switch op.Op {
+		case XMLOpSet, XMLOpDelete:
+		case XMLOpWrap:
+			if op.Element == "" {
+				return nil, fmt.Errorf("operation %d: element is required", i)
+			}
+		default:
+			return nil, fmt.Errorf("operation %d: unsupported operation: %s", i, op.Op)
+		}
+
+		var err error
+		if op.path, err = parseXMLPath(op.Path); err != nil {
+			return nil, fmt.Errorf("operation %d: %w", i, err)
+		}
+
+		x.ops = append(x.ops, op)
+	}
+
+	if len(x.ops) == 0 && !config.FaultToJSON {
+		return nil, fmt.Errorf("operations or faultToJson are required")
+	}
+
+	return x, nil
+}
+
+// parseXMLPath parses element path
+func parseXMLPath(path string) (xmlPath, error) {
+	var p xmlPath
+
+	switch {
+	case strings.HasPrefix(path, "//"):
+		p.anywhere = true
+		path = path[2:]
+	case strings.HasPrefix(path, "/"):
+		path = path[1:]
+	default:
+		return p, fmt.Errorf("path must start with / or //: %s", path)
+	}
+
+	for _, step := range strings.Split(path, "/") {
+		if step == "" {
+			return p, fmt.Errorf("path has empty steps: %s", path)
+		}
+
+		if i := strings.IndexByte(step, ':'); i >= 0 {
+			step = step[i+1:] // prefixes are ignored
+		}
+
+		p.steps = append(p.steps, step)
+	}
+
+	return p, nil
+}
+
+// match checks if the path matches element with the stack of local names of its ancestors and itself
+func (p *xmlPath) match(stack []string) bool {
+	if len(stack) < len(p.steps) || (!p.anywhere && len(stack) != len(p.steps)) {
+		return false
+	}
+
+	stack = stack[len(stack)-len(p.steps):]
+	for i, step := range p.steps {
+		if step != "*" && step != stack[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// matches checks if the body contains element matching the rule
+func (x *xmlRules) matches(s *responseState) bool {
+	if x.match == nil {
+		return true
+	}
+
+	if s.spill != nil {
+		return false // spilled bodies are not parsed
+	}
+
+	tokens, err := parseXML(s.body.Bytes())
+	if err != nil {
+		return false
+	}
+
+	var stack []string
+	for _, t := range tokens {
+		switch t := t.(type) {
+		case xml.StartElement:
+			if stack = append(stack, t.Name.Local); x.match.match(stack) {
+				return true
+			}
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+		}
+	}
+
+	return false
+}
+
+// transformXML applies XML transformation to the body. Returns false if the body is not an XML document
+func (s *responseState) transformXML(x *xmlRules, vars *templateVars) bool {
+	if s.spill != nil {
+		return false // spilled bodies are not parsed
+	}
+
+	tokens, err := parseXML(s.body.Bytes())
+	if err != nil {
+		return false
+	}
+
+	for i := range x.ops {
+		tokens = x.ops[i].apply(tokens, vars)
+	}
+
+	if x.config.FaultToJSON {
+		if body := faultJSON(tokens); body != nil {
+			s.body.Reset()
+			s.body.Write(body)
+			s.headers.Set("Content-Type", "application/json")
+
+			return true
+		}
+	}
+
+	s.body.Reset()
+	writeXML(s.body, tokens)
+
+	return true
+}
+
+// apply applies the operation to matching elements. Elements nested into matching ones are not matched
+func (op *xmlOp) apply(tokens []xml.Token, vars *templateVars) []xml.Token {
+	modified := make([]xml.Token, 0, len(tokens)+2)
+
+	var stack []string
+	for i := 0; i < len(tokens); i++ {
+		switch t := tokens[i].(type) {
+		case xml.StartElement:
+			stack = append(stack, t.Name.Local)
+			if !op.path.match(stack) {
+				break
+			}
+
+			end := elementEnd(tokens, i)
+			modified = op.modify(modified, tokens[i:end+1], vars)
+			stack = stack[:len(stack)-1]
+			i = end
+
+			continue
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+		}
+
+		modified = append(modified, tokens[i])
+	}
+
+	return modified
+}
+
+// modify appends element tokens modified by the operation
+func (op *xmlOp) modify(tokens []xml.Token, element []xml.Token, vars *templateVars) []xml.Token {
+	switch op.Op {
+	case XMLOpDelete:
+		return tokens
+	case XMLOpWrap:
+		name := xml.Name{Local: op.Element}
+		tokens = append(tokens, xml.StartElement{Name: name})
+		tokens = append(tokens, element...)
+
+		return append(tokens, xml.EndElement{Name: name})
+	}
+
+	value := op.Value
+	if op.template {
+		value = renderTemplate(value, vars, nil)
+	}
+
+	start := element[0].(xml.StartElement)
+
+	if op.Attr == "" {
+		return append(tokens, start, xml.CharData(value), element[len(element)-1])
+	}
+
+	attrs := make([]xml.Attr, 0, len(start.Attr)+1) // attributes are shared with parsed tokens
+	found := false
+	for _, attr := range start.Attr {
+		if qualifiedName(attr.Name) == op.Attr {
+			attr.Value, found = value, true
+		}
+
+		attrs = append(attrs, attr)
+	}
+
+	if !found {
+		attrs = append(attrs, xml.Attr{Name: xml.Name{Local: op.Attr}, Value: value})
+	}
+
+	start.Attr = attrs
+	tokens = append(tokens, start)
+
+	return append(tokens, element[1:]...)
+}
+
+// elementEnd returns index of the end token of the element starting at the index
+func elementEnd(tokens []xml.Token, start int) int {
+	depth := 0
+	for i := start; i < len(tokens); i++ {
+		switch tokens[i].(type) {
+		case xml.StartElement:
+			depth++
+		case xml.EndElement:
+			if depth--; depth == 0 {
+				return i
+			}
+		}
+	}
+
+	return len(tokens) - 1 // unreachable for parsed documents
+}
+
+// parseXML reads tokens of XML document keeping namespace prefixes as they are
+func parseXML(data []byte) ([]xml.Token, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+
+	var tokens []xml.Token
+	var stack []xml.Name
+	root := false
+
+	for {
+		t, err := decoder.RawToken()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := t.(type) {
+		case xml.StartElement:
+			if len(stack) == 0 && root {
+				return nil, fmt.Errorf("multiple root elements")
+			}
+
+			root = true
+			stack = append(stack, t.Name)
+		case xml.EndElement:
+			if len(stack) == 0 || stack[len(stack)-1] != t.Name { // raw tokens are not checked by decoder
+				return nil, fmt.Errorf("unexpected end element </%s>", qualifiedName(t.Name))
+			}
+
+			stack = stack[:len(stack)-1]
+		case xml.CharData:
+			if len(stack) == 0 && len(bytes.TrimSpace(t)) > 0 {
+				return nil, fmt.Errorf("text outside of root element")
+			}
+		}
+
+		tokens = append(tokens, xml.CopyToken(t))
+	}
+
+	if !root || len(stack) > 0 {
+		return nil, fmt.Errorf("not an XML document")
+	}
+
+	return tokens, nil
+}
+
+var (
+	xmlTextEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+	xmlAttrEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", `"`, "&quot;")
+)
+
+// writeXML serializes tokens keeping namespace prefixes as they are. Elements without contents are self-closed
+func writeXML(b *bytes.Buffer, tokens []xml.Token) {
+	for i := 0; i < len(tokens); i++ {
+		switch t := tokens[i].(type) {
+		case xml.StartElement:
+			b.WriteByte('<')
+			b.WriteString(qualifiedName(t.Name))
+
+			for _, attr := range t.Attr {
+				b.WriteByte(' ')
+				b.WriteString(qualifiedName(attr.Name))
+				b.WriteString(`="`)
+				_, _ = xmlAttrEscaper.WriteString(b, attr.Value)
+				b.WriteByte('"')
+			}
+
+			if i+1 < len(tokens) {
+				if _, ok := tokens[i+1].(xml.EndElement); ok {
+					b.WriteString("/>")
+					i++
+
+					continue
+				}
+			}
+
+			b.WriteByte('>')
+		case xml.EndElement:
+			b.WriteString("</")
+			b.WriteString(qualifiedName(t.Name))
+			b.WriteByte('>')
+		case xml.CharData:
+			_, _ = xmlTextEscaper.WriteString(b, string(t))
+		case xml.Comment:
+			b.WriteString("<!--")
+			b.Write(t)
+			b.WriteString("-->")
+		case xml.ProcInst:
+			b.WriteString("<?")
+			b.WriteString(t.Target)
+			if len(t.Inst) > 0 {
+				b.WriteByte(' ')
+				b.Write(t.Inst)
+			}
+			b.WriteString("?>")
+		case xml.Directive:
+			b.WriteString("<!")
+			b.Write(t)
+			b.WriteByte('>')
+		}
+	}
+}
+
+// qualifiedName returns element or attribute name with its namespace prefix
+func qualifiedName(name xml.Name) string {
+	if name.Space == "" {
+		return name.Local
+	}
+
+	return name.Space + ":" + name.Local
+}
+
+// soapFaultPaths are paths of SOAP 1.1 and 1.2 fault elements relative to Fault element
+var soapFaultPaths = map[string]string{
+	"faultcode":   "code",
+	"Code/Value":  "code",
+	"faultstring": "message",
+	"Reason/Text": "message",
+	"detail":      "detail",
+	"Detail":      "detail",
+}
+
+// soapFault is a SOAP fault converted to JSON
+type soapFault struct {
+	Error struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+		Detail  string `json:"detail,omitempty"`
+	} `json:"error"`
+}
+
+// faultJSON converts SOAP fault to JSON error body. Returns nil if the document has no fault
+func faultJSON(tokens []xml.Token) []byte {
+	var stack []string
+	for i, t := range tokens {
+		switch t := t.(type) {
+		case xml.StartElement:
+			if t.Name.Local == "Fault" && len(stack) > 0 && stack[len(stack)-1] == "Body" {
+				return convertFault(tokens[i : elementEnd(tokens, i)+1])
+			}
+
+			stack = append(stack, t.Name.Local)
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+		}
+	}
+
+	return nil
+}
+
+// convertFault converts tokens of SOAP Fault element to JSON
+func convertFault(tokens []xml.Token) []byte {
+	values := map[string]string{}
+
+	var stack []string
+	for i := 1; i < len(tokens)-1; i++ { // fault children
+		switch t := tokens[i].(type) {
+		case xml.StartElement:
+			stack = append(stack, t.Name.Local)
+
+			field, ok := soapFaultPaths[strings.Join(stack, "/")]
+			if _, found := values[field]; ok && !found {
+				values[field] = elementText(tokens[i : elementEnd(tokens, i)+1])
+			}
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+		}
+	}
+
+	var fault soapFault
+	fault.Error.Code = values["code"]
+	fault.Error.Message = values["message"]
+	fault.Error.Detail = values["detail"]
+
+	var body bytes.Buffer
+	encoder := json.NewEncoder(&body)
+	encoder.SetEscapeHTML(false) // messages are not embedded into HTML
+	_ = encoder.Encode(fault)
+
+	return bytes.TrimSuffix(body.Bytes(), []byte("\n"))
+}
+
+// elementText returns text contents of element and its descendants with whitespace collapsed
+func elementText(tokens []xml.Token) string {
+	var b strings.Builder
+	for _, t := range tokens {
+		if text, ok := t.(xml.CharData); ok {
+			b.Write(text)
+			b.WriteByte(' ')
+		}
+	}
+
+	return strings.Join(strings.Fields(b.String()), " ")
+}
@@ -0,0 +1,221 @@
+package traefik_change_response_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	changeresponse "github.com/bravepickle/traefik-change-response"
+)
+
+const soapFault11 = `<?xml version="1.0" encoding="UTF-8"?>
+<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/">
+<soap:Body>
+<soap:Fault>
+<faultcode>soap:Server</faultcode>
+<faultstring>Account &amp; balance service is unavailable</faultstring>
+<detail><error code="42">Try again
+later</error></detail>
+</soap:Fault>
+</soap:Body>
+</soap:Envelope>`
+
+const soapFault12 = `<env:Envelope xmlns:env="http://www.w3.org/2003/05/soap-envelope">
+<env:Body><env:Fault>
+<env:Code><env:Value>env:Receiver</env:Value></env:Code>
+<env:Reason><env:Text xml:lang="en">Timeout</env:Text></env:Reason>
+</env:Fault></env:Body>
+</env:Envelope>`
+
+const soapResponse = `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/">` +
+	`<soap:Body><m:Balance xmlns:m="urn:bank"><m:Amount currency="EUR">10</m:Amount><m:Secret>s3cret</m:Secret>` +
+	`<m:Note/></m:Balance></soap:Body></soap:Envelope>`
+
+func TestXML(t *testing.T) {
+	xmlHeaders := http.Header{"Content-Type": []string{"text/xml; charset=utf-8"}}
+
+	datasets := []struct {
+		name            string
+		transform       changeresponse.XMLTransform
+		body            string
+		expectedCode    int
+		expectedType    string
+		expectedBody    string
+		expectedHeaders http.Header
+	}{
+		{
+			name:         "SOAP 1.1 fault to JSON",
+			transform:    changeresponse.XMLTransform{Match: "/Envelope/Body/Fault", FaultToJSON: true},
+			body:         soapFault11,
+			expectedCode: http.StatusBadGateway,
+			expectedType: "application/json",
+			expectedBody: `{"error":{"code":"soap:Server","message":"Account & balance service is unavailable",` +
+				`"detail":"Try again later"}}`,
+		},
+		{
+			name:         "SOAP 1.2 fault to JSON",
+			transform:    changeresponse.XMLTransform{Match: "//soap:Fault", FaultToJSON: true},
+			body:         soapFault12,
+			expectedCode: http.StatusBadGateway,
+			expectedType: "application/json",
+			expectedBody: `{"error":{"code":"env:Receiver","message":"Timeout"}}`,
+		},
+		{
+			name:         "match is missing",
+			transform:    changeresponse.XMLTransform{Match: "/Envelope/Body/Fault", FaultToJSON: true},
+			body:         soapResponse,
+			expectedCode: http.StatusInternalServerError,
+			expectedType: "text/xml; charset=utf-8",
+			expectedBody: soapResponse,
+		},
+		{
+			name:         "not xml",
+			transform:    changeresponse.XMLTransform{FaultToJSON: true},
+			body:         "Some error",
+			expectedCode: http.StatusBadGateway,
+			expectedType: "text/xml; charset=utf-8",
+			expectedBody: "Some error",
+		},
+		{
+			name: "element operations",
+			transform: changeresponse.XMLTransform{
+				Ops: []changeresponse.XMLOp{
+					{Op: changeresponse.XMLOpDelete, Path: "//Secret"},
+					{Op: changeresponse.XMLOpSet, Path: "//Balance/Amount", Value: "<hidden>"},
+					{Op: changeresponse.XMLOpSet, Path: "//Amount", Attr: "currency", Value: "USD"},
+					{Op: changeresponse.XMLOpSet, Path: "/Envelope/Body/*/Note", Attr: "method", Value: "{{method}}"},
+					{Op: changeresponse.XMLOpWrap, Path: "/Envelope/Body/Balance", Element: "m:Result"},
+				},
+				FaultToJSON: true,
+			},
+			body:         soapResponse,
+			expectedCode: http.StatusBadGateway,
+			expectedType: "text/xml; charset=utf-8",
+			expectedBody: `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body><m:Result>` +
+				`<m:Balance xmlns:m="urn:bank"><m:Amount currency="USD">&lt;hidden&gt;</m:Amount>` +
+				`<m:Note method="GET"/></m:Balance></m:Result></soap:Body></soap:Envelope>`,
+		},
+		{
+			name: "comments and declarations are kept",
+			transform: changeresponse.XMLTransform{
+				Ops: []changeresponse.XMLOp{{Op: changeresponse.XMLOpDelete, Path: "/a/b"}},
+			},
+			body:         `<?xml version="1.0"?>` + "\n" + `<!-- note --><a x="&quot;1&quot;"><b>2</b><c>3 &lt; 4</c></a>`,
+			expectedCode: http.StatusBadGateway,
+			expectedType: "text/xml; charset=utf-8",
+			expectedBody: `<?xml version="1.0"?>` + "\n" + `<!-- note --><a x="&quot;1&quot;"><c>3 &lt; 4</c></a>`,
+		},
+	}
+
+	for _, d := range datasets {
+		t.Run(d.name, func(t *testing.T) {
+			transform := d.transform
+
+			recorder := servePlugin(t, inputDataset{
+				config: changeresponse.Config{
+					Overrides: []changeresponse.Override{{
+						From: []int{500},
+						To:   502,
+						Mode: changeresponse.ModeXML,
+						XML:  &transform,
+					}},
+				},
+				responseCode:    http.StatusInternalServerError,
+				responseHeaders: xmlHeaders,
+				responseBody:    d.body,
+			})
+
+			if recorder.Code != d.expectedCode {
+				t.Errorf("Status code mismatch: got %d, want %d", recorder.Code, d.expectedCode)
+			}
+
+			if actual := recorder.Header().Get("Content-Type"); actual != d.expectedType {
+				t.Errorf("Content-Type mismatch: got %q, want %q", actual, d.expectedType)
+			}
+
+			if actual := recorder.Body.String(); actual != d.expectedBody {
+				t.Errorf("Body mismatch\nactual:   %s\nexpected: %s", actual, d.expectedBody)
+			}
+		})
+	}
+}
+
+func TestXMLConfig(t *testing.T) {
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {})
+
+	datasets := []struct {
+		name     string
+		override changeresponse.Override
+		expected string
+	}{
+		{
+			name:     "missing transformation",
+			override: changeresponse.Override{From: []int{500}, To: 200, Mode: changeresponse.ModeXML},
+			expected: "override 0: xml transformation is required in xml mode",
+		},
+		{
+			name: "transformation without xml mode",
+			override: changeresponse.Override{
+				From: []int{500},
+				To:   200,
+				XML:  &changeresponse.XMLTransform{FaultToJSON: true},
+			},
+			expected: "override 0: xml transformation is supported only in xml mode",
+		},
+		{
+			name: "no operations",
+			override: changeresponse.Override{
+				From: []int{500},
+				To:   200,
+				Mode: changeresponse.ModeXML,
+				XML:  &changeresponse.XMLTransform{Match: "//Fault"},
+			},
+			expected: "override 0: xml: operations or faultToJson are required",
+		},
+		{
+			name: "relative path",
+			override: changeresponse.Override{
+				From: []int{500},
+				To:   200,
+				Mode: changeresponse.ModeXML,
+				XML:  &changeresponse.XMLTransform{Match: "Fault", FaultToJSON: true},
+			},
+			expected: "override 0: xml: match: path must start with / or //: Fault",
+		},
+		{
+			name: "wrap without element",
+			override: changeresponse.Override{
+				From: []int{500},
+				To:   200,
+				Mode: changeresponse.ModeXML,
+				XML: &changeresponse.XMLTransform{
+					Ops: []changeresponse.XMLOp{{Op: changeresponse.XMLOpWrap, Path: "/a"}},
+				},
+			},
+			expected: "override 0: xml: operation 0: element is required",
+		},
+		{
+			name: "unsupported operation",
+			override: changeresponse.Override{
+				From: []int{500},
+				To:   200,
+				Mode: changeresponse.ModeXML,
+				XML: &changeresponse.XMLTransform{
+					Ops: []changeresponse.XMLOp{{Op: "rename", Path: "/a"}},
+				},
+			},
+			expected: "override 0: xml: operation 0: unsupported operation: rename",
+		},
+	}
+
+	for _, d := range datasets {
+		t.Run(d.name, func(t *testing.T) {
+			config := &changeresponse.Config{Overrides: []changeresponse.Override{d.override}}
+
+			_, err := changeresponse.New(context.Background(), next, config, "test-plugin")
+			if err == nil || err.Error() != d.expected {
+				t.Errorf("Unexpected error\nactual:   %v\nexpected: %s", err, d.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,586 @@
+package traefik_change_response
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// yamlToJSON converts YAML document to JSON, so that it is decoded the same way as JSON documents. Supported is the
+// subset of YAML used by configuration files: block and flow mappings and sequences, plain and quoted scalars, literal
+// and folded block scalars and comments. Anchors, aliases, tags and multi-document streams are rejected
+func yamlToJSON(data []byte) ([]byte, error) {
+	text := strings.TrimSuffix(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n") // terminates the last line
+	p := &yamlParser{lines: strings.Split(text, "\n")}
+
+	doc, err := p.parseDocument()
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(doc)
+}
+
+// yamlParser parses YAML document line by line
+type yamlParser struct {
+	lines []string
+	pos   int // current line
+}
+
+// parseDocument parses the whole document
+func (p *yamlParser) parseDocument() (any, error) {
+	p.skipEmpty()
+
+	if p.pos < len(p.lines) && strings.TrimSpace(p.lines[p.pos]) == "---" {
+		p.pos++
+		p.skipEmpty()
+	}
+
+	if p.eof() {
+		return nil, nil
+	}
+
+	doc, err := p.parseBlock(p.indent())
+	if err != nil {
+		return nil, err
+	}
+
+	p.skipEmpty()
+
+	if !p.eof() && strings.HasPrefix(p.lines[p.pos], "---") {
+		return nil, p.errorf("multiple documents are not supported")
+	}
+
+	if !p.eof() && !p.documentMarker() {
+		return nil, p.errorf("unexpected indentation")
+	}
+
+	return doc, nil
+}
+
+// parseBlock parses block collection starting at the current line
+func (p *yamlParser) parseBlock(indent int) (any, error) {
+	if isSequenceItem(p.content()) {
+		return p.parseSequence(indent)
+	}
+
+	return p.parseMapping(indent)
+}
+
+// parseSequence parses block sequence items with the indentation
+func (p *yamlParser) parseSequence(indent int) ([]any, error) {
+	list := []any{}
+
+	for p.skipEmpty(); !p.eof() && !p.documentMarker() && p.indent() == indent && isSequenceItem(p.content()); p.skipEmpty() {
+		content := p.content()
+		rest := strings.TrimLeft(content[1:], " ")
+		column := indent + len(content) - len(rest)
+
+		var item any
+		var err error
+
+		switch {
+		case stripComment(rest) == "":
+			item, err = p.parseNested(indent, false)
+		case isSequenceItem(rest) || isMappingEntry(rest):
+			// nested collection starts on the same line, parse it as if it was on the next one
+			p.lines[p.pos] = strings.Repeat(" ", column) + rest
+			item, err = p.parseBlock(column)
+		default:
+			item, err = p.parseValue(stripComment(rest), indent)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		list = append(list, item)
+	}
+
+	if !p.eof() && !p.documentMarker() && p.indent() > indent {
+		return nil, p.errorf("unexpected indentation")
+	}
+
+	return list, nil
+}
+
+// parseMapping parses block mapping entries with the indentation
+func (p *yamlParser) parseMapping(indent int) (map[string]any, error) {
+	mapping := map[string]any{}
+
+	for p.skipEmpty(); !p.eof() && !p.documentMarker() && p.indent() == indent; p.skipEmpty() {
+		content := p.content()
+		if isSequenceItem(content) {
+			break // sequence of the parent mapping key
+		}
+
+		key, rest, ok := splitMappingEntry(content)
+		if !ok {
+			return nil, p.errorf("mapping entry expected")
+		}
+
+		if _, ok := mapping[key]; ok {
+			return nil, p.errorf("duplicate key %q", key)
+		}
+
+		var value any
+		var err error
+
+		if rest = stripComment(rest); rest == "" {
+			value, err = p.parseNested(indent, true)
+		} else {
+			value, err = p.parseValue(rest, indent)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		mapping[key] = value
+	}
+
+	if !p.eof() && !p.documentMarker() && p.indent() > indent {
+		return nil, p.errorf("unexpected indentation")
+	}
+
+	return mapping, nil
+}
+
+// parseNested parses value defined on lines following the current one. Sequences may be nested in mappings without
+// extra indentation
+func (p *yamlParser) parseNested(indent int, allowSameIndent bool) (any, error) {
+	p.pos++
+	p.skipEmpty()
+
+	if p.eof() {
+		return nil, nil
+	}
+
+	if p.documentMarker() {
+		return nil, nil
+	}
+
+	if next := p.indent(); next > indent || (allowSameIndent && next == indent && isSequenceItem(p.content())) {
+		return p.parseBlock(next)
+	}
+
+	return nil, nil
+}
+
+// parseValue parses value defined on the current line
+func (p *yamlParser) parseValue(text string, indent int) (any, error) {
+	if text[0] == '|' || text[0] == '>' {
+		return p.parseBlockScalar(text, indent)
+	}
+
+	line := p.pos + 1
+
+	if err := checkPlain(text); err != nil {
+		return nil, p.errorf("%s", err)
+	}
+
+	p.pos++
+
+	if text[0] != '[' && text[0] != '{' && text[0] != '"' && text[0] != '\'' {
+		return resolvePlain(text), nil
+	}
+
+	s := &flowScanner{text: text}
+
+	value, err := s.parseValue()
+	if err == nil && s.skipSpaces() < len(text) {
+		err = fmt.Errorf("unexpected %q", text[s.pos:])
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("yaml: line %d: %w", line, err)
+	}
+
+	return value, nil
+}
+
+// parseBlockScalar parses literal (|) or folded (>) multiline string
+func (p *yamlParser) parseBlockScalar(header string, indent int) (string, error) {
+	style, chomping := header[0], header[1:]
+	if chomping != "" && chomping != "-" && chomping != "+" {
+		return "", p.errorf("unsupported block scalar header %q", header)
+	}
+
+	p.pos++
+
+	var lines []string
+	blockIndent := -1
+
+	for ; p.pos < len(p.lines); p.pos++ {
+		line := p.lines[p.pos]
+		if strings.TrimSpace(line) == "" {
+			lines = append(lines, "")
+
+			continue
+		}
+
+		lineIndent := len(line) - len(strings.TrimLeft(line, " "))
+		if lineIndent <= indent || (blockIndent >= 0 && lineIndent < blockIndent) {
+			break
+		}
+
+		if blockIndent < 0 {
+			blockIndent = lineIndent
+		}
+
+		lines = append(lines, line[blockIndent:])
+	}
+
+	// trailing blank lines are handled by chomping
+	trailing := 0
+	for trailing < len(lines) && lines[len(lines)-1-trailing] == "" {
+		trailing++
+	}
+
+	lines = lines[:len(lines)-trailing]
+
+	var value string
+	if style == '|' {
+		value = strings.Join(lines, "\n")
+	} else {
+		value = foldLines(lines)
+	}
+
+	switch {
+	case len(lines) == 0:
+		return "", nil
+	case chomping == "-":
+		return value, nil
+	case chomping == "+":
+		return value + strings.Repeat("\n", trailing+1), nil
+	default:
+		return value + "\n", nil
+	}
+}
+
+// foldLines joins lines of folded block scalar with spaces. Line breaks are kept around empty and more indented lines
+func foldLines(lines []string) string {
+	var b strings.Builder
+
+	for i, line := range lines {
+		if line == "" {
+			b.WriteByte('\n') // empty line replaces the preceding line break
+
+			continue
+		}
+
+		if i > 0 && lines[i-1] != "" {
+			if line[0] == ' ' || lines[i-1][0] == ' ' {
+				b.WriteByte('\n')
+			} else {
+				b.WriteByte(' ')
+			}
+		}
+
+		b.WriteString(line)
+	}
+
+	return b.String()
+}
+
+// skipEmpty moves to the next line having contents
+func (p *yamlParser) skipEmpty() {
+	for ; p.pos < len(p.lines); p.pos++ {
+		if content := stripComment(strings.TrimSpace(p.lines[p.pos])); content != "" {
+			return
+		}
+	}
+}
+
+// eof checks if all lines are parsed
+func (p *yamlParser) eof() bool {
+	return p.pos >= len(p.lines)
+}
+
+// documentMarker checks if the current line starts (---) or ends (...) the document
+func (p *yamlParser) documentMarker() bool {
+	line := strings.TrimRight(p.lines[p.pos], " ")
+
+	return line == "---" || line == "..." || strings.HasPrefix(line, "--- ") || strings.HasPrefix(line, "... ")
+}
+
+// indent returns indentation of the current line
+func (p *yamlParser) indent() int {
+	line := p.lines[p.pos]
+
+	return len(line) - len(strings.TrimLeft(line, " "))
+}
+
+// content returns current line without indentation
+func (p *yamlParser) content() string {
+	return strings.TrimSpace(p.lines[p.pos])
+}
+
+// errorf creates error pointing to the current line
+func (p *yamlParser) errorf(format string, args ...any) error {
+	return fmt.Errorf("yaml: line %d: %s", p.pos+1, fmt.Sprintf(format, args...))
+}
+
+// isSequenceItem checks if line contents start block sequence item
+func isSequenceItem(content string) bool {
+	return content == "-" || strings.HasPrefix(content, "- ")
+}
+
+// isMappingEntry checks if line contents start block mapping entry
+func isMappingEntry(content string) bool {
+	if content[0] == '[' || content[0] == '{' {
+		return false
+	}
+
+	_, _, ok := splitMappingEntry(content)
+
+	return ok
+}
+
+// splitMappingEntry splits mapping entry into the key and the rest of the line
+func splitMappingEntry(content string) (key string, rest string, ok bool) {
+	end := scanQuoted(content, 0)
+
+	for i := end; i < len(content); i++ {
+		if content[i] == ':' && (i+1 == len(content) || content[i+1] == ' ') {
+			key = strings.TrimSpace(content[:i])
+			rest = strings.TrimSpace(content[i+1:])
+
+			if end > 0 {
+				var err error
+				if key, err = unquote(key); err != nil {
+					return "", "", false
+				}
+			}
+
+			return key, rest, true
+		}
+
+		if content[i] == ' ' && i+1 < len(content) && content[i+1] == '#' {
+			break
+		}
+	}
+
+	return "", "", false
+}
+
+// stripComment removes comment from the end of line contents
+func stripComment(text string) string {
+	for i := 0; i < len(text); i++ {
+		switch {
+		case text[i] == '"' || text[i] == '\'':
+			if i == 0 || text[i-1] == ' ' || text[i-1] == '[' || text[i-1] == '{' || text[i-1] == ',' {
+				i = scanQuoted(text, i) - 1
+			}
+		case text[i] == '#' && (i == 0 || text[i-1] == ' '):
+			return strings.TrimSpace(text[:i])
+		}
+	}
+
+	return strings.TrimSpace(text)
+}
+
+// scanQuoted returns position after quoted string starting at the position, or the position if it is not quoted
+func scanQuoted(text string, start int) int {
+	if start >= len(text) || (text[start] != '"' && text[start] != '\'') {
+		return start
+	}
+
+	quote := text[start]
+
+	for i := start + 1; i < len(text); i++ {
+		switch {
+		case quote == '"' && text[i] == '\\':
+			i++
+		case text[i] == quote && quote == '\'' && i+1 < len(text) && text[i+1] == '\'':
+			i++ // escaped single quote
+		case text[i] == quote:
+			return i + 1
+		}
+	}
+
+	return len(text)
+}
+
+// unquote decodes single or double-quoted string
+func unquote(text string) (string, error) {
+	if len(text) < 2 || text[len(text)-1] != text[0] {
+		return "", fmt.Errorf("unterminated string %s", text)
+	}
+
+	if text[0] == '\'' {
+		return strings.ReplaceAll(text[1:len(text)-1], "''", "'"), nil
+	}
+
+	return strconv.Unquote(text)
+}
+
+// checkPlain rejects scalars starting with YAML indicators of unsupported features
+func checkPlain(text string) error {
+	switch text[0] {
+	case '&', '*':
+		return fmt.Errorf("anchors and aliases are not supported: %s", text)
+	case '!':
+		return fmt.Errorf("tags are not supported: %s", text)
+	case '@', '`', '%':
+		return fmt.Errorf("reserved indicator %q can not start plain scalar", text[0])
+	}
+
+	return nil
+}
+
+// resolvePlain converts plain scalar to null, boolean, number or string
+func resolvePlain(text string) any {
+	switch text {
+	case "", "~", "null", "Null", "NULL":
+		return nil
+	case "true", "True", "TRUE":
+		return true
+	case "false", "False", "FALSE":
+		return false
+	}
+
+	if n, err := strconv.ParseInt(text, 10, 64); err == nil {
+		return n
+	}
+
+	if f, err := strconv.ParseFloat(text, 64); err == nil {
+		return f
+	}
+
+	return text
+}
+
+// flowScanner parses flow collections and quoted scalars
+type flowScanner struct {
+	text string
+	pos  int
+}
+
+// skipSpaces moves past whitespace returning the new position
+func (s *flowScanner) skipSpaces() int {
+	for s.pos < len(s.text) && s.text[s.pos] == ' ' {
+		s.pos++
+	}
+
+	return s.pos
+}
+
+// parseValue parses flow value at the current position
+func (s *flowScanner) parseValue() (any, error) {
+	if s.skipSpaces() >= len(s.text) {
+		return nil, fmt.Errorf("value expected")
+	}
+
+	switch s.text[s.pos] {
+	case '[':
+		return s.parseSequence()
+	case '{':
+		return s.parseMapping()
+	case '"', '\'':
+		end := scanQuoted(s.text, s.pos)
+		value, err := unquote(s.text[s.pos:end])
+		s.pos = end
+
+		return value, err
+	}
+
+	if err := checkPlain(s.text[s.pos:]); err != nil {
+		return nil, err
+	}
+
+	start := s.pos
+	for s.pos < len(s.text) && !strings.ContainsRune(",]}", rune(s.text[s.pos])) {
+		if s.text[s.pos] == ':' && (s.pos+1 == len(s.text) || s.text[s.pos+1] == ' ') {
+			break
+		}
+
+		s.pos++
+	}
+
+	return resolvePlain(strings.TrimSpace(s.text[start:s.pos])), nil
+}
+
+// parseSequence parses flow sequence
+func (s *flowScanner) parseSequence() ([]any, error) {
+	list := []any{}
+	s.pos++ // [
+
+	for {
+		if s.skipSpaces() < len(s.text) && s.text[s.pos] == ']' {
+			s.pos++
+
+			return list, nil
+		}
+
+		item, err := s.parseValue()
+		if err != nil {
+			return nil, err
+		}
+
+		list = append(list, item)
+
+		if err := s.parseSeparator(']'); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// parseMapping parses flow mapping
+func (s *flowScanner) parseMapping() (map[string]any, error) {
+	mapping := map[string]any{}
+	s.pos++ // {
+
+	for {
+		if s.skipSpaces() < len(s.text) && s.text[s.pos] == '}' {
+			s.pos++
+
+			return mapping, nil
+		}
+
+		key, err := s.parseValue()
+		if err != nil {
+			return nil, err
+		}
+
+		if s.skipSpaces() >= len(s.text) || s.text[s.pos] != ':' {
+			return nil, fmt.Errorf("':' expected after mapping key")
+		}
+
+		s.pos++
+
+		value, err := s.parseValue()
+		if err != nil {
+			return nil, err
+		}
+
+		name := fmt.Sprint(key)
+		if _, ok := mapping[name]; ok {
+			return nil, fmt.Errorf("duplicate key %q", name)
+		}
+
+		mapping[name] = value
+
+		if err := s.parseSeparator('}'); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// parseSeparator moves past comma between collection items. Collection end is left to be consumed by the caller
+func (s *flowScanner) parseSeparator(end byte) error {
+	if s.skipSpaces() >= len(s.text) {
+		return fmt.Errorf("unterminated flow collection")
+	}
+
+	switch s.text[s.pos] {
+	case ',':
+		s.pos++
+	case end:
+	default:
+		return fmt.Errorf("unexpected %q in flow collection", s.text[s.pos])
+	}
+
+	return nil
+}